@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/mrinalxdev/cli-code/scanner"
+)
+
+// baselineGrowth is a language that grew past its -baseline allowance
+type baselineGrowth struct {
+	Name     string
+	Baseline int
+	Current  int
+}
+
+// saveBaseline writes the per-language counts in the -format json layout,
+// so a saved report works as a baseline too
+func saveBaseline(path string, report scanner.Report) error {
+	data, err := json.MarshalIndent(jsonReport{Languages: report.Languages, Totals: &report.Totals}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// loadBaseline reads the line count per language from a saved report
+func loadBaseline(path string) (map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var saved jsonReport
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	lines := make(map[string]int, len(saved.Languages))
+	for _, data := range saved.Languages {
+		lines[data.Name] = data.Stats.LineCount
+	}
+	return lines, nil
+}
+
+// baselineRegressions lists the languages with more than threshold percent
+// lines over their baseline, largest growth first. A language missing from
+// the baseline starts from zero, so any lines of it count as growth.
+func baselineRegressions(baseline map[string]int, languageData []scanner.LanguageData, threshold float64) []baselineGrowth {
+	var grown []baselineGrowth
+	for _, data := range languageData {
+		before := baseline[data.Name]
+		if float64(data.Stats.LineCount) > float64(before)*(1+threshold/100) {
+			grown = append(grown, baselineGrowth{Name: data.Name, Baseline: before, Current: data.Stats.LineCount})
+		}
+	}
+	sort.Slice(grown, func(i, j int) bool {
+		a, b := grown[i].Current-grown[i].Baseline, grown[j].Current-grown[j].Baseline
+		if a != b {
+			return a > b
+		}
+		return grown[i].Name < grown[j].Name
+	})
+	return grown
+}
+
+// describe renders the growth for the -baseline error listing
+func (g baselineGrowth) describe() string {
+	if g.Baseline == 0 {
+		return fmt.Sprintf("%d lines, not in the baseline", g.Current)
+	}
+	return fmt.Sprintf("%d → %d lines (%+.1f%%)", g.Baseline, g.Current, float64(g.Current-g.Baseline)*100/float64(g.Baseline))
+}
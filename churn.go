@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/mrinalxdev/cli-code/scanner"
+)
+
+// sortChurn puts the languages with the most lines touched first
+func sortChurn(data []scanner.ChurnData) {
+	sort.SliceStable(data, func(i, j int) bool {
+		a := data[i].Stats.Added + data[i].Stats.Removed
+		b := data[j].Stats.Added + data[j].Stats.Removed
+		return a > b
+	})
+}
+
+func churnRow(name string, stats scanner.ChurnStats) []string {
+	return []string{
+		name,
+		strconv.Itoa(stats.Changes),
+		"+" + strconv.Itoa(stats.Added),
+		"-" + strconv.Itoa(stats.Removed),
+		signed(int64(stats.Added - stats.Removed)),
+	}
+}
+
+// printChurnTable writes the -git-churn report
+func printChurnTable(out io.Writer, root, revRange string, data []scanner.ChurnData, totals scanner.ChurnStats) {
+	fmt.Fprintf(out, "\n📈 Git Churn (%s, %s)\n\n", root, revRange)
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.TabIndent)
+	separators := []string{"--------", "-------", "-----", "-------", "---"}
+	printTableLine(w, []string{"Language", "Changes", "Added", "Removed", "Net"})
+	printTableLine(w, separators)
+	for _, lang := range data {
+		printTableLine(w, churnRow(lang.Name, lang.Stats))
+	}
+	if len(data) > 0 {
+		printTableLine(w, separators)
+	}
+	printTableLine(w, churnRow("Total", totals))
+	w.Flush()
+}
+
+type jsonChurnReport struct {
+	Range     string              `json:"range"`
+	Languages []scanner.ChurnData `json:"languages"`
+	Totals    scanner.ChurnStats  `json:"totals"`
+}
+
+func printChurnJSON(out io.Writer, revRange string, data []scanner.ChurnData, totals scanner.ChurnStats) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jsonChurnReport{Range: revRange, Languages: data, Totals: totals})
+}
+
+func printChurnCSV(out io.Writer, data []scanner.ChurnData, totals scanner.ChurnStats) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"language", "changes", "added", "removed"})
+	for _, lang := range append(data, scanner.ChurnData{Name: "Total", Stats: totals}) {
+		w.Write([]string{
+			lang.Name,
+			strconv.Itoa(lang.Stats.Changes),
+			strconv.Itoa(lang.Stats.Added),
+			strconv.Itoa(lang.Stats.Removed),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
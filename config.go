@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config files looked up in the scan root, then in the home directory
+var configFileNames = []string{".tokie.json", ".tokie.yml", ".tokie.yaml"}
+
+// findConfigFile returns the first config file found in dirs, or ""
+func findConfigFile(dirs ...string) string {
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		for _, name := range configFileNames {
+			candidate := filepath.Join(dir, name)
+			if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
+
+// loadConfig reads a config file into flag name -> value pairs. Keys are
+// the long flag names (e.g. "skip-dirs"); list values are joined with
+// commas so they read the same as on the command line.
+func loadConfig(filename string) (map[string]string, error) {
+	if strings.HasSuffix(filename, ".json") {
+		return loadJSONConfig(filename)
+	}
+	return loadYAMLConfig(filename)
+}
+
+func loadJSONConfig(filename string) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	config := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			config[key] = strings.Join(items, ",")
+		default:
+			config[key] = fmt.Sprint(v)
+		}
+	}
+	return config, nil
+}
+
+// loadYAMLConfig understands the flat subset of YAML a config needs:
+// "key: value" scalars, inline [a, b] lists and "- item" block lists.
+func loadYAMLConfig(filename string) (map[string]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config := make(map[string]string)
+	var listKey string
+	lineNum := 0
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "- ") {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", lineNum)
+			}
+			item := unquoteYAML(strings.TrimSpace(line[2:]))
+			if config[listKey] != "" {
+				config[listKey] += ","
+			}
+			config[listKey] += item
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", lineNum)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		listKey = ""
+		switch {
+		case value == "":
+			listKey = key
+			config[key] = ""
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			var items []string
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = unquoteYAML(strings.TrimSpace(item)); item != "" {
+					items = append(items, item)
+				}
+			}
+			config[key] = strings.Join(items, ",")
+		default:
+			config[key] = unquoteYAML(value)
+		}
+	}
+	return config, scanner.Err()
+}
+
+func unquoteYAML(value string) string {
+	if len(value) >= 2 {
+		if (value[0] == '"' && value[len(value)-1] == '"') || (value[0] == '\'' && value[len(value)-1] == '\'') {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+// applyConfig sets every configured flag that wasn't given on the
+// command line, so explicit flags always win.
+func applyConfig(config map[string]string) error {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for key, value := range config {
+		if flag.Lookup(key) == nil {
+			return fmt.Errorf("unknown option %q", key)
+		}
+		if key == "path" || explicit[key] {
+			continue
+		}
+		if err := flag.Set(key, value); err != nil {
+			return fmt.Errorf("invalid value for %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Environment variables read for flags not given on the command line.
+// They take precedence over the config file.
+var envFlags = map[string]string{
+	"TOKIE_PATH":    "path",
+	"TOKIE_FORMAT":  "format",
+	"TOKIE_WORKERS": "workers",
+}
+
+// applyEnv sets flags from their environment variables. TOKIE_PATH may
+// hold several roots separated like $PATH and is only used when no path
+// was given as a flag or argument.
+func applyEnv() error {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for env, name := range envFlags {
+		value, ok := os.LookupEnv(env)
+		if !ok || value == "" || explicit[name] {
+			continue
+		}
+		values := []string{value}
+		if name == "path" {
+			if flag.NArg() > 0 {
+				continue
+			}
+			values = filepath.SplitList(value)
+		}
+		for _, v := range values {
+			if err := flag.Set(name, v); err != nil {
+				return fmt.Errorf("invalid %s: %w", env, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mrinalxdev/cli-code/scanner"
+)
+
+// languageDelta compares one language between the two -diff trees
+type languageDelta struct {
+	Name   string                `json:"language"`
+	Before scanner.LanguageStats `json:"before"`
+	After  scanner.LanguageStats `json:"after"`
+	Delta  scanner.LanguageStats `json:"delta"`
+}
+
+// diffReports pairs up the languages of two scans, largest line change
+// first. A language found on one side only is zero on the other.
+func diffReports(before, after scanner.Report) (deltas []languageDelta, totals languageDelta) {
+	byName := make(map[string]*languageDelta)
+	entry := func(name string) *languageDelta {
+		if _, ok := byName[name]; !ok {
+			byName[name] = &languageDelta{Name: name}
+		}
+		return byName[name]
+	}
+	for _, data := range before.Languages {
+		entry(data.Name).Before = data.Stats
+	}
+	for _, data := range after.Languages {
+		entry(data.Name).After = data.Stats
+	}
+
+	for _, delta := range byName {
+		delta.Delta = subtractStats(delta.After, delta.Before)
+		deltas = append(deltas, *delta)
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		a, b := abs(deltas[i].Delta.LineCount), abs(deltas[j].Delta.LineCount)
+		if a != b {
+			return a > b
+		}
+		return deltas[i].Name < deltas[j].Name
+	})
+
+	totals = languageDelta{Name: "Total", Before: before.Totals, After: after.Totals}
+	totals.Delta = subtractStats(after.Totals, before.Totals)
+	return deltas, totals
+}
+
+func subtractStats(a, b scanner.LanguageStats) scanner.LanguageStats {
+	return scanner.LanguageStats{
+		FileCount:     a.FileCount - b.FileCount,
+		LineCount:     a.LineCount - b.LineCount,
+		CodeLines:     a.CodeLines - b.CodeLines,
+		CommentLines:  a.CommentLines - b.CommentLines,
+		BlankLines:    a.BlankLines - b.BlankLines,
+		LogicalLines:  a.LogicalLines - b.LogicalLines,
+		TabIndented:   a.TabIndented - b.TabIndented,
+		SpaceIndented: a.SpaceIndented - b.SpaceIndented,
+		ByteCount:     a.ByteCount - b.ByteCount,
+		MaxBytes:      a.MaxBytes - b.MaxBytes,
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// signed renders a change with an explicit sign, "0" when unchanged
+func signed(n int64) string {
+	if n > 0 {
+		return "+" + strconv.FormatInt(n, 10)
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// signedKB renders a byte change in KB the same way
+func signedKB(n int64) string {
+	if n == 0 {
+		return "0.00"
+	}
+	return fmt.Sprintf("%+.2f", float64(n)/1024)
+}
+
+// printDiffTable writes the -diff report: the line counts on each side
+// and the signed change of every column
+func printDiffTable(out io.Writer, dirA, dirB string, deltas []languageDelta, totals languageDelta) {
+	fmt.Fprintf(out, "\n🔀 Code Statistics Diff (%s → %s)\n\n", dirA, dirB)
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.TabIndent)
+	headers := []string{"Language", "Lines Before", "Lines After", "Files", "Lines", "Code", "Comments", "Blanks", "Size (KB)"}
+	separators := make([]string, len(headers))
+	for i, header := range headers {
+		separators[i] = strings.Repeat("-", len(header))
+	}
+
+	printTableLine(w, headers)
+	printTableLine(w, separators)
+	for _, delta := range deltas {
+		printTableLine(w, diffTableRow(delta))
+	}
+	if len(deltas) > 0 {
+		printTableLine(w, separators)
+	}
+	printTableLine(w, diffTableRow(totals))
+	w.Flush()
+}
+
+func diffTableRow(delta languageDelta) []string {
+	return []string{
+		delta.Name,
+		strconv.Itoa(delta.Before.LineCount),
+		strconv.Itoa(delta.After.LineCount),
+		signed(int64(delta.Delta.FileCount)),
+		signed(int64(delta.Delta.LineCount)),
+		signed(int64(delta.Delta.CodeLines)),
+		signed(int64(delta.Delta.CommentLines)),
+		signed(int64(delta.Delta.BlankLines)),
+		signedKB(delta.Delta.ByteCount),
+	}
+}
+
+type jsonDiffReport struct {
+	Before    string          `json:"before"`
+	After     string          `json:"after"`
+	Languages []languageDelta `json:"languages"`
+	Totals    languageDelta   `json:"totals"`
+}
+
+// printDiffJSON writes both sides and the change for every language
+func printDiffJSON(out io.Writer, dirA, dirB string, deltas []languageDelta, totals languageDelta) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jsonDiffReport{Before: dirA, After: dirB, Languages: deltas, Totals: totals})
+}
+
+// printDiffCSV writes the signed change per language and a totals row
+func printDiffCSV(out io.Writer, deltas []languageDelta, totals languageDelta) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"language", "lines_before", "lines_after", "files_delta", "lines_delta", "code_delta", "comments_delta", "blanks_delta", "bytes_delta"})
+	for _, delta := range append(deltas, totals) {
+		w.Write([]string{
+			delta.Name,
+			strconv.Itoa(delta.Before.LineCount),
+			strconv.Itoa(delta.After.LineCount),
+			strconv.Itoa(delta.Delta.FileCount),
+			strconv.Itoa(delta.Delta.LineCount),
+			strconv.Itoa(delta.Delta.CodeLines),
+			strconv.Itoa(delta.Delta.CommentLines),
+			strconv.Itoa(delta.Delta.BlankLines),
+			strconv.FormatInt(delta.Delta.ByteCount, 10),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
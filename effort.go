@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mrinalxdev/cli-code/scanner"
+)
+
+// defaultEffortWeights scale a code line of each language to a rough
+// common effort, Go being 1. Terse languages weigh more per line, markup
+// and config less. Languages missing here weigh 1.
+var defaultEffortWeights = map[string]float64{
+	"Go":                      1.0,
+	"C":                       0.9,
+	"C++":                     1.0,
+	"Java":                    0.8,
+	"Kotlin":                  1.1,
+	"Swift":                   1.1,
+	"Rust":                    1.1,
+	"Python":                  1.3,
+	"Ruby":                    1.3,
+	"Perl":                    1.3,
+	"PHP":                     1.0,
+	"JavaScript":              1.0,
+	"TypeScript":              1.0,
+	"JSX":                     0.9,
+	"TSX":                     0.9,
+	"TypeScript Declarations": 0.3,
+	"Shell":                   1.2,
+	"SQL":                     1.0,
+	"HTML":                    0.5,
+	"CSS":                     0.5,
+	"SCSS":                    0.6,
+	"Sass":                    0.6,
+	"Less":                    0.6,
+	"Template":                0.6,
+	"YAML":                    0.3,
+	"TOML":                    0.3,
+	"INI":                     0.3,
+	"Markdown":                0.2,
+	"reStructuredText":        0.2,
+}
+
+// effortRow is one language's share of the -effort estimate
+type effortRow struct {
+	Name   string
+	Code   int
+	Weight float64
+	Effort float64
+}
+
+// parseEffortWeights reads comma-separated "Language=weight" overrides on
+// top of the defaults
+func parseEffortWeights(value string) (map[string]float64, error) {
+	weights := make(map[string]float64, len(defaultEffortWeights))
+	for name, weight := range defaultEffortWeights {
+		weights[name] = weight
+	}
+	for _, item := range splitList(value) {
+		name, number, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q should look like Language=1.5", item)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("%q has no valid weight", item)
+		}
+		// "python=2" replaces the default for Python
+		for existing := range weights {
+			if strings.EqualFold(existing, name) {
+				delete(weights, existing)
+			}
+		}
+		weights[name] = weight
+	}
+	return weights, nil
+}
+
+// effortWeight looks name up ignoring case, 1 when it has no weight
+func effortWeight(weights map[string]float64, name string) float64 {
+	if weight, ok := weights[name]; ok {
+		return weight
+	}
+	for candidate, weight := range weights {
+		if strings.EqualFold(candidate, name) {
+			return weight
+		}
+	}
+	return 1
+}
+
+// computeEffort weighs each language's code lines, largest effort first
+func computeEffort(languageData []scanner.LanguageData, weights map[string]float64) ([]effortRow, float64) {
+	rows := make([]effortRow, 0, len(languageData))
+	var total float64
+	for _, data := range languageData {
+		weight := effortWeight(weights, data.Name)
+		row := effortRow{Name: data.Name, Code: data.Stats.CodeLines, Weight: weight, Effort: float64(data.Stats.CodeLines) * weight}
+		rows = append(rows, row)
+		total += row.Effort
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Effort != rows[j].Effort {
+			return rows[i].Effort > rows[j].Effort
+		}
+		return rows[i].Name < rows[j].Name
+	})
+	return rows, total
+}
+
+// printEffort writes the weighted code lines per language and their sum
+func printEffort(out io.Writer, rows []effortRow, total float64) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.TabIndent)
+	fmt.Fprintf(w, "\n⚖️  Effort Estimate (weighted code lines)\n\n")
+	printTableLine(w, []string{"Language", "Code", "Weight", "Effort"})
+	printTableLine(w, []string{"--------", "----", "------", "------"})
+	for _, row := range rows {
+		printTableLine(w, []string{row.Name, strconv.Itoa(row.Code), strconv.FormatFloat(row.Weight, 'g', -1, 64), fmt.Sprintf("%.0f", row.Effort)})
+	}
+	printTableLine(w, []string{"Total", "", "", fmt.Sprintf("%.0f", total)})
+	w.Flush()
+}
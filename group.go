@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mrinalxdev/cli-code/scanner"
+)
+
+// languageCategories rolls languages up into the buckets shown by -group.
+// Languages missing here land in "Other".
+var languageCategories = map[string]string{
+	"JavaScript":              "Frontend",
+	"TypeScript":              "Frontend",
+	"TypeScript Declarations": "Frontend",
+	"JSX":                     "Frontend",
+	"TSX":                     "Frontend",
+	"HTML":                    "Frontend",
+	"CSS":                     "Frontend",
+	"SCSS":                    "Frontend",
+	"Sass":                    "Frontend",
+	"Less":                    "Frontend",
+	"Vue":                     "Frontend",
+	"Svelte":                  "Frontend",
+	"Template":                "Frontend",
+	"Go":                      "Backend",
+	"Java":                    "Backend",
+	"Python":                  "Backend",
+	"Ruby":                    "Backend",
+	"PHP":                     "Backend",
+	"Rust":                    "Backend",
+	"Perl":                    "Backend",
+	"C":                       "Systems",
+	"C++":                     "Systems",
+	"Swift":                   "Mobile",
+	"Kotlin":                  "Mobile",
+	"R":                       "Data",
+	"Julia":                   "Data",
+	"Shell":                   "Scripts",
+	"Docker":                  "Build",
+	"Make":                    "Build",
+	"CMake":                   "Build",
+	"SQL":                     "Data",
+	"YAML":                    "Config",
+	"TOML":                    "Config",
+	"INI":                     "Config",
+	"Markdown":                "Documentation",
+	"reStructuredText":        "Documentation",
+}
+
+// groupByCategory merges the per-language rows into one row per category
+func groupByCategory(languageData []scanner.LanguageData) []scanner.LanguageData {
+	byCategory := make(map[string]*scanner.LanguageStats)
+	var order []string
+	for _, data := range languageData {
+		category, ok := languageCategories[data.Name]
+		if !ok {
+			category = "Other"
+		}
+		if _, exists := byCategory[category]; !exists {
+			byCategory[category] = &scanner.LanguageStats{}
+			order = append(order, category)
+		}
+		byCategory[category].Add(data.Stats)
+	}
+
+	grouped := make([]scanner.LanguageData, 0, len(order))
+	for _, category := range order {
+		grouped = append(grouped, scanner.LanguageData{Name: category, Stats: *byCategory[category]})
+	}
+	return grouped
+}
+
+// keepTop keeps the first n rows and folds the rest into a trailing
+// "Other" row, merging with an "Other" row already among the first n
+func keepTop(languageData []scanner.LanguageData, n int) []scanner.LanguageData {
+	if n <= 0 || len(languageData) <= n {
+		return languageData
+	}
+	kept := append([]scanner.LanguageData(nil), languageData[:n]...)
+	other := scanner.LanguageData{Name: "Other"}
+	for i := 0; i < len(kept); i++ {
+		if kept[i].Name == other.Name {
+			other.Stats = kept[i].Stats
+			kept = append(kept[:i], kept[i+1:]...)
+			break
+		}
+	}
+	for _, data := range languageData[n:] {
+		other.Stats.Add(data.Stats)
+	}
+	return append(kept, other)
+}
+
+// mergeRule folds several rows into one, from a -merge "A+B=Name" rule
+type mergeRule struct {
+	names []string
+	into  string
+}
+
+// parseMergeRules reads comma-separated "A+B=Name" rules
+func parseMergeRules(value string) ([]mergeRule, error) {
+	var rules []mergeRule
+	for _, item := range splitList(value) {
+		names, into, ok := strings.Cut(item, "=")
+		into = strings.TrimSpace(into)
+		if !ok || into == "" {
+			return nil, fmt.Errorf("%q should look like A+B=Name", item)
+		}
+		rule := mergeRule{into: into}
+		for _, name := range strings.Split(names, "+") {
+			if name = strings.TrimSpace(name); name != "" {
+				rule.names = append(rule.names, name)
+			}
+		}
+		if len(rule.names) == 0 {
+			return nil, fmt.Errorf("%q names no languages to merge", item)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// applyMergeRules combines the rows each rule names, matched ignoring
+// case, into a single row where the first of them was
+func applyMergeRules(languageData []scanner.LanguageData, rules []mergeRule) []scanner.LanguageData {
+	for _, rule := range rules {
+		merged := languageData[:0:0]
+		at := -1
+		for _, data := range languageData {
+			if !scanner.ContainsFold(rule.names, data.Name) {
+				merged = append(merged, data)
+				continue
+			}
+			if at < 0 {
+				at = len(merged)
+				merged = append(merged, scanner.LanguageData{Name: rule.into})
+			}
+			merged[at].Stats.Add(data.Stats)
+		}
+		languageData = merged
+	}
+	return languageData
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"html/template"
+	"io"
+
+	"github.com/mrinalxdev/cli-code/scanner"
+)
+
+// htmlReport is what htmlTemplate renders
+type htmlReport struct {
+	Title   string
+	Headers []string
+	Rows    [][]string
+	Total   []string
+	Bars    []htmlBar
+}
+
+// htmlBar is one language's share of lines in the chart below the table
+type htmlBar struct {
+	Name  string
+	Share float64
+}
+
+// htmlTemplate is a self-contained page: inline CSS, no scripts or
+// external resources, so it can be mailed or attached as is
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Code Statistics: {{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #1f2328; margin: 2rem; }
+h1 { font-size: 1.4rem; }
+h2 { font-size: 1.1rem; margin-top: 2rem; }
+table { border-collapse: collapse; font-variant-numeric: tabular-nums; }
+th, td { padding: 0.35rem 0.8rem; border-bottom: 1px solid #d0d7de; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+thead th { background: #f6f8fa; }
+tbody tr:nth-child(even) { background: #fafbfc; }
+tfoot td { font-weight: bold; border-top: 2px solid #8c959f; }
+.chart { max-width: 48rem; }
+.bar { display: flex; align-items: center; margin: 0.25rem 0; }
+.bar span { width: 12rem; }
+.bar div { background: #2f81f7; height: 1rem; margin-right: 0.5rem; }
+</style>
+</head>
+<body>
+<h1>🔍 Code Statistics Report ({{.Title}})</h1>
+<table>
+<thead><tr>{{range .Headers}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</tbody>
+{{if .Total}}<tfoot><tr>{{range .Total}}<td>{{.}}</td>{{end}}</tr></tfoot>
+{{end}}</table>
+{{if .Bars}}<h2>📊 Share of lines</h2>
+<div class="chart">
+{{range .Bars}}<div class="bar"><span>{{.Name}}</span><div style="width: {{printf "%.1f" .Share}}%"></div>{{printf "%.1f" .Share}}%</div>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
+
+// printHTML writes the report as a complete HTML page with the table and
+// a bar chart of each row's share of lines
+func printHTML(out io.Writer, title string, languageData []scanner.LanguageData, totals scanner.LanguageStats, opts reportOptions) error {
+	if opts.estimated {
+		title += ", estimated from a sample"
+	}
+	report := htmlReport{Title: title, Headers: tableHeaders(opts)}
+	for _, data := range languageData {
+		report.Rows = append(report.Rows, tableRow(data.Name, data.Stats, totals, opts))
+		share := 0.0
+		if totals.LineCount > 0 {
+			share = float64(data.Stats.LineCount) * 100 / float64(totals.LineCount)
+		}
+		report.Bars = append(report.Bars, htmlBar{Name: data.Name, Share: share})
+	}
+	if !opts.hideTotal {
+		report.Total = tableRow("Total", totals, totals, opts)
+	}
+	return htmlTemplate.Execute(out, report)
+}
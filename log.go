@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/mrinalxdev/cli-code/scanner"
+)
+
+// newLogger returns the -log-level logger for diagnostics. It writes
+// "level=WARN msg=..." lines without timestamps, which only clutter a
+// short-lived command's output.
+func newLogger(out io.Writer, level string) (*slog.Logger, error) {
+	var min slog.Level
+	if err := min.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown -log-level %q (expected debug, info, warn or error)", level)
+	}
+	handler := slog.NewTextHandler(out, &slog.HandlerOptions{
+		Level: min,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})
+	return slog.New(handler), nil
+}
+
+// scanWarn adapts a logger to scanner.Options.Warn, with the problem as
+// the message and the file it concerns as an attribute
+func scanWarn(logger *slog.Logger) func(scanner.FileError) {
+	return func(problem scanner.FileError) {
+		logger.Warn(problem.Err.Error(), "path", problem.Path)
+	}
+}
@@ -2,253 +2,1340 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
-	"sync"
-	"text/tabwriter"
+	"syscall"
 	"time"
-)
 
-type LanguageStats struct {
-	FileCount int
-	LineCount int
-	ByteCount int64
-	mutex     sync.Mutex
-}
+	"github.com/mrinalxdev/cli-code/scanner"
+)
 
-type FileResult struct {
-	path     string
-	language string
-}
+// version is set at build time with
+// -ldflags "-X main.version=v1.2.3"
+var version = "dev"
 
 type SortOption struct {
-	Field     string // "files", "lines", "size"
+	Field     string // "files", "lines", "size", "name"
 	Direction string // "asc", "desc"
 }
 
-var languageExtMap = map[string]string{
-	".go":    "Go",
-	".py":    "Python",
-	".js":    "JavaScript",
-	".ts":    "TypeScript",
-	".java":  "Java",
-	".cpp":   "C++",
-	".c":     "C",
-	".rb":    "Ruby",
-	".php":   "PHP",
-	".rs":    "Rust",
-	".swift": "Swift",
-	".kt":    "Kotlin",
+// validSortFields are the fields compareLanguageData knows, for -sort
+var validSortFields = map[string]bool{"files": true, "lines": true, "size": true, "name": true}
+
+// pathList collects repeated -path flags
+type pathList []string
+
+func (p *pathList) String() string {
+	return strings.Join(*p, ",")
 }
 
-type LanguageData struct {
-	Name      string
-	Stats     LanguageStats
+func (p *pathList) Set(value string) error {
+	*p = append(*p, value)
+	return nil
 }
 
 func main() {
 	startTime := time.Now()
 
-	excludePtr := flag.String("exclude", "", "Comma-separated list of file patterns to exclude (e.g. '*.json,*.yml')")
-	sortPtr := flag.String("sort", "", "Sort by: files/lines/size asc/desc (e.g. 'files desc')")
+	excludePtr := flag.String("exclude", "", "Comma-separated list of file patterns to exclude, relative to the scan root (e.g. '*.json,vendor/*,dist/**')")
+	includePtr := flag.String("include", "", "Comma-separated list of file patterns to count, skipping all other files (e.g. '*_test.go,internal/**')")
+	extPtr := flag.String("ext", "", "Comma-separated list of extensions to count, skipping all other files; unknown ones are shown by extension (e.g. '.go,.rs')")
+	onlyPtr := flag.String("only", "", "Comma-separated list of languages to count, skipping all others (e.g. 'Go,Python')")
+	sortPtr := flag.String("sort", "", "Sort by one or more comma-separated files/lines/size/name criteria, each asc (default) or desc as 'lines desc' or 'lines:desc' (e.g. 'lines:desc,files:desc')")
 	skipNodeModules := flag.Bool("skip-node-modules", false, "Skip node_modules directories")
+	skipDirsPtr := flag.String("skip-dirs", "", "Comma-separated list of directory names to prune from the walk (e.g. '.git,node_modules,vendor')")
+	maxDepth := flag.Int("max-depth", -1, "Maximum directory depth below each root to descend into (0 = root only, -1 = unlimited)")
+	noCache := flag.Bool("no-cache", false, "Recount every file instead of reusing counts cached from earlier runs")
+	sample := flag.Float64("sample", 0, "Count only this random fraction of the files (e.g. 0.1) and scale the totals up to an estimate")
+	workers := flag.Int("workers", 0, "Number of goroutines walking and counting files (0 = one per CPU)")
+	timeout := flag.Duration("timeout", 0, "Stop scanning after this long (e.g. 30s) and report what was counted, marked as partial (0 = no limit)")
+	profile := flag.Bool("profile", false, "Print how long walking, counting and reporting each took")
+	stream := flag.Bool("stream", false, "Print each language as its first file is counted, with running totals, before the report")
+	quiet := flag.Bool("quiet", false, "Don't show scan progress")
+	strict := flag.Bool("strict", false, "Exit with status 2 when no recognised files are found")
+	verbose := flag.Bool("verbose", false, "List every file that couldn't be read, not just how many")
+	noPercent := flag.Bool("no-percent", false, "Hide the percentage-of-total columns")
+	mergePtr := flag.String("merge", "", "Combine languages into one row, as comma-separated A+B=Name rules (e.g. 'JavaScript+TypeScript=JS/TS')")
+	group := flag.Bool("group", false, "Roll languages up into categories (Frontend, Backend, ...) with a row per category")
+	byDir := flag.Bool("by-dir", false, "Show a row per top-level directory below the scan root instead of per language")
+	width := flag.Int("width", 0, "Pad every table column to this many characters so the layout is the same on every run (0 = fit to contents)")
+	human := flag.Bool("human", false, "Show sizes in B/KB/MB/GB as fits instead of always KB")
+	noTotal := flag.Bool("no-total", false, "Leave the totals row out of the report")
+	summary := flag.Bool("summary", false, "Only print the grand totals, without the per-language rows")
+	showFiles := flag.Bool("files", false, "Also list every scanned file with its language and line count")
+	indent := flag.Bool("indent", false, "Also report how many lines per language are indented with tabs and with spaces")
+	lineEndings := flag.Bool("line-endings", false, "Also report how many files per language use LF, CRLF or both (table and json)")
+	relative := flag.Bool("relative", false, "Show -files paths relative to their scan root instead of as given")
+	top := flag.Int("top", 0, "Show only the N largest languages by the sort order and fold the rest into an Other row (0 = all)")
+	maxLinesPerFile := flag.Int("max-lines-per-file", 0, "Exit with status 3, listing the offenders, when any file has more than N lines (0 = no limit)")
+	baselinePath := flag.String("baseline", "", "Exit with status 4 when any language has grown past its line count in this saved JSON report")
+	baselineThreshold := flag.Float64("baseline-threshold", 0, "Percentage a language may grow over its -baseline before failing")
+	saveBaselinePath := flag.String("save-baseline", "", "Write the per-language counts to this file for later -baseline runs")
+	filesSortPtr := flag.String("files-sort", "", "Order the -files listing by comma-separated language/lines/code/size/path criteria, in -sort's syntax (e.g. 'language,lines:desc')")
+	topFiles := flag.Int("top-files", 0, "Limit the -files listing to the N largest files (0 = all)")
+	readOnly := flag.Bool("read-only", false, "Guarantee nothing is written below the scan roots or read outside them: refuses -o and -save-baseline inside a root and -follow-symlinks, skips symlinks leading out and the cache")
+	followSymlinks := flag.Bool("follow-symlinks", false, "Descend into symlinked directories, skipping any already visited")
+	gitTracked := flag.Bool("git-tracked", false, "Only count files tracked by git (falls back to a full walk outside a repository)")
+	listOnly := flag.Bool("list", false, "Print the files that would be counted, without reading them, and exit")
+	includeOther := flag.Bool("include-other", false, "Also list files of no known language (images, binaries, ...) by extension, with their size only (table and json)")
+	docs := flag.Bool("docs", false, "Also count documentation (.md, .markdown, .rst), left out of the totals by default")
+	skipGenerated := flag.Bool("skip-generated", false, "Skip files whose header marks them as generated (e.g. '// Code generated ... DO NOT EDIT.')")
+	noDTS := flag.Bool("no-dts", false, "Skip TypeScript declaration (.d.ts) files instead of counting them separately")
+	minFiles := flag.Int("min-files", 0, "Hide languages with fewer than N files (they still count towards the totals)")
+	outPath := flag.String("o", "", "Write the report to this file instead of stdout")
+	repoURL := flag.String("repo", "", "Shallow-clone this git repository URL into a temporary directory, scan it instead of local paths, and remove it afterwards")
+	gitChurn := flag.String("git-churn", "", "Report lines added and removed per language by the commits in this git revision range (e.g. 'v1.0..HEAD') instead of scanning")
+	diffMode := flag.Bool("diff", false, "Compare two paths (tokie -diff old new) and print the change per language")
+	fromStdin := flag.Bool("stdin", false, "Count exactly the newline-separated file paths read from stdin, without walking")
+	watch := flag.Bool("watch", false, "Keep running and re-print the report whenever files change")
+	watchInterval := flag.Duration("watch-interval", 2*time.Second, "How often -watch polls for changes")
+	noColor := flag.Bool("no-color", false, "Disable coloured output (also off when stdout isn't a terminal or NO_COLOR is set)")
+	showChart := flag.Bool("chart", false, "Draw a bar chart of each language's share of lines below the table")
+	maxFileSizePtr := flag.String("max-file-size", "", "Skip files larger than this size (e.g. 500KB, 2MB)")
+	noHidden := flag.Bool("no-hidden", false, "Skip files and directories whose name starts with '.' (counted by default)")
+	deepPtr := flag.String("deep", "", "Split code/comments/blanks only for these comma-separated languages; others just get a fast line count (e.g. 'Go,Python')")
+	effort := flag.Bool("effort", false, "Also print an effort estimate: code lines weighted per language by how much each line says; heuristic (table)")
+	effortWeightsPtr := flag.String("effort-weights", "", "Override -effort weights as comma-separated Language=weight pairs (e.g. 'Python=1.5,YAML=0')")
+	headLines := flag.Int("head", 0, "Only count the first N lines of each file, e.g. for license headers; reading stops there (0 = whole files)")
+	logical := flag.Bool("logical", false, "Also count logical lines (statements) for C-style languages; heuristic")
+	caseSensitive := flag.Bool("case-sensitive", false, "Match extensions case-sensitively, so .C is C++ and .c is C (default: lower-cased)")
+	sincePtr := flag.String("since", "", "Only count files modified within this window (e.g. 7d, 12h, 2w) or since a date (2024-01-31 or RFC3339)")
+	respectGitignore := flag.Bool("respect-gitignore", false, "Skip paths matched by .gitignore files found while walking")
+	langMapPtr := flag.String("langmap", "", "JSON file of {\".ext\": \"Language\"} pairs added on top of the built-in map")
+	whichPtr := flag.String("which", "", "Print the language an extension (.kt) or file name (Dockerfile) is counted as, with any -langmap, and exit")
+	countPtr := flag.String("count", "", "Print only the total lines, files or bytes as a bare integer (e.g. -count lines)")
+	formatPtr := flag.String("format", "table", "Output format: table, json, ndjson, csv, markdown, prometheus or html")
+	logLevel := flag.String("log-level", "warn", "Diagnostics written to stderr: debug, info, warn or error")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+	var rootPaths pathList
+	flag.Var(&rootPaths, "path", "Directory or file to scan, may be repeated (defaults to the current directory)")
 	flag.Parse()
+	defer runCleanups()
 
-	// Parse sorting options
-	var sortOpt SortOption
-	if *sortPtr != "" {
-		parts := strings.Fields(*sortPtr)
-		if len(parts) == 2 {
-			sortOpt.Field = strings.ToLower(parts[0])
-			sortOpt.Direction = strings.ToLower(parts[1])
-		} else {
-			fmt.Println("Invalid sort format. Using default sorting.")
+	if *showVersion {
+		// go install'ed builds carry their module version instead
+		if info, ok := debug.ReadBuildInfo(); ok && version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+		fmt.Printf("tokie %s (%s, %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+		return
+	}
+
+	if err := applyEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	// Defaults from .tokie.json/.tokie.yml in the scan root or home directory
+	configDir := "."
+	if len(rootPaths) > 0 {
+		configDir = rootPaths[0]
+	} else if flag.NArg() > 0 {
+		configDir = flag.Arg(0)
+	}
+	if info, err := os.Stat(configDir); err == nil && !info.IsDir() {
+		configDir = filepath.Dir(configDir)
+	}
+	homeDir, _ := os.UserHomeDir()
+	configFile := findConfigFile(configDir, homeDir)
+	if configFile != "" {
+		config, err := loadConfig(configFile)
+		if err == nil {
+			err = applyConfig(config)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config %s: %v\n", configFile, err)
+			exit(1)
+		}
+	}
+
+	logger, err := newLogger(os.Stderr, *logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	if configFile != "" {
+		logger.Info("loaded config", "file", configFile)
+	}
+
+	format := strings.ToLower(*formatPtr)
+	switch format {
+	case "table", "json", "ndjson", "csv", "markdown", "prometheus", "html":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected table, json, ndjson, csv, markdown, prometheus or html)\n", *formatPtr)
+		exit(1)
+	}
+
+	countField := strings.ToLower(*countPtr)
+	switch countField {
+	case "", "lines", "files", "bytes":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown -count %q (expected lines, files or bytes)\n", *countPtr)
+		exit(1)
+	}
+	if countField != "" && (*watch || *diffMode || *listOnly) {
+		fmt.Fprintln(os.Stderr, "Error: -count can't be combined with -watch, -diff or -list")
+		exit(1)
+	}
+
+	// Status lines go to stderr so they don't corrupt machine-readable output
+	info := os.Stdout
+	if format != "table" || countField != "" {
+		info = os.Stderr
+	}
+
+	var customLanguages map[string]string
+	if *langMapPtr != "" {
+		custom, err := loadLangMap(*langMapPtr, *caseSensitive)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading langmap %s: %v\n", *langMapPtr, err)
+			exit(1)
 		}
+		customLanguages = custom
 	}
 
-	homeDir, err := os.UserHomeDir()
+	// -which only resolves the mapping, it scans nothing
+	if *whichPtr != "" {
+		lookup := scanner.Options{Languages: customLanguages, CaseSensitive: *caseSensitive}
+		lang, ok := lookup.Language(*whichPtr)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: no language for %q\n", *whichPtr)
+			exit(1)
+		}
+		fmt.Println(lang)
+		return
+	}
+
+	// Parse sorting options, e.g. "lines desc, files desc"
+	parsedSort, err := parseSortCriteria(*sortPtr)
 	if err != nil {
-		fmt.Printf("Error getting home directory: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error: invalid -sort: %v\n", err)
+		exit(1)
 	}
-	desktopPath := filepath.Join(homeDir, "Desktop")
+	// A typo in a field or direction warns and is ignored, unless -strict
+	var sortOpts []SortOption
+	for _, opt := range parsedSort {
+		if problem := sortProblem(opt, validSortFields); problem != "" {
+			if *strict {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", problem)
+				exit(1)
+			}
+			logger.Warn(problem + ", ignoring it")
+			continue
+		}
+		sortOpts = append(sortOpts, opt)
+	}
+
+	filesSort, err := parseSortCriteria(*filesSortPtr)
+	for _, opt := range filesSort {
+		if problem := sortProblem(opt, validFilesSortFields); problem != "" && err == nil {
+			err = errors.New(problem)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid -files-sort: %v\n", err)
+		exit(1)
+	}
+
+	// -repo scans a fresh shallow clone in place of any local path
+	if *repoURL != "" {
+		if len(rootPaths) > 0 || flag.NArg() > 0 || *watch || *fromStdin || *readOnly {
+			fmt.Fprintln(os.Stderr, "Error: -repo replaces the paths to scan and can't be combined with them, -watch, -stdin or -read-only")
+			exit(1)
+		}
+		logger.Info("cloning", "repo", *repoURL)
+		dir, err := cloneRepo(*repoURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error cloning %s: %v\n", *repoURL, err)
+			exit(1)
+		}
+		rootPaths = pathList{dir}
+		// The temporary directory means nothing once it's gone
+		*relative = true
+	}
+
+	// Resolve the scan roots: -path flags and positional args, then cwd
+	rootPaths = append(rootPaths, flag.Args()...)
+	if len(rootPaths) == 0 {
+		cwd, err := os.Getwd()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting current directory: %v\n", err)
+			exit(1)
+		}
+		rootPaths = append(rootPaths, cwd)
+	}
+	for _, rootPath := range rootPaths {
+		rootInfo, err := os.Stat(rootPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: cannot access %s: %v\n", rootPath, err)
+			exit(1)
+		}
+		if !rootInfo.IsDir() && !rootInfo.Mode().IsRegular() {
+			fmt.Fprintf(os.Stderr, "Error: %s is not a directory or regular file\n", rootPath)
+			exit(1)
+		}
+	}
+	if *readOnly {
+		if err := checkReadOnly(rootPaths, *followSymlinks, *outPath, *saveBaselinePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -read-only: %v\n", err)
+			exit(1)
+		}
+	}
+	// A piped file list replaces the walk, e.g. git diff --name-only | tokie -stdin
+	var stdinPaths []string
+	if *fromStdin {
+		if *watch || *diffMode || *listOnly {
+			fmt.Fprintln(os.Stderr, "Error: -stdin can't be combined with -watch, -diff or -list")
+			exit(1)
+		}
+		lines := bufio.NewScanner(os.Stdin)
+		for lines.Scan() {
+			if line := strings.TrimSpace(lines.Text()); line != "" {
+				stdinPaths = append(stdinPaths, line)
+			}
+		}
+		if err := lines.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading paths from stdin: %v\n", err)
+			exit(1)
+		}
+	}
+
+	var maxFileSize int64
+	if *maxFileSizePtr != "" {
+		size, err := parseSize(*maxFileSizePtr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -max-file-size: %v\n", err)
+			exit(1)
+		}
+		maxFileSize = size
+	}
+
+	var since time.Time
+	if *sincePtr != "" {
+		t, err := parseSince(*sincePtr, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -since: %v\n", err)
+			exit(1)
+		}
+		since = t
+	}
+
+	mergeRules, err := parseMergeRules(*mergePtr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid -merge: %v\n", err)
+		exit(1)
+	}
+
+	effortWeights, err := parseEffortWeights(*effortWeightsPtr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid -effort-weights: %v\n", err)
+		exit(1)
+	}
+
+	if *byDir && (*group || mergeRules != nil) {
+		fmt.Fprintln(os.Stderr, "Error: -by-dir can't be combined with -group or -merge")
+		exit(1)
+	}
+
+	if *sample < 0 || *sample > 1 {
+		fmt.Fprintf(os.Stderr, "Error: -sample must be between 0 and 1, got %g\n", *sample)
+		exit(1)
+	}
+	if *width < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -width must be positive, got %d\n", *width)
+		exit(1)
+	}
+	if *top < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -top must be positive, got %d\n", *top)
+		exit(1)
+	}
+	if *maxLinesPerFile < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -max-lines-per-file must be positive, got %d\n", *maxLinesPerFile)
+		exit(1)
+	}
+	var baseline map[string]int
+	if *baselinePath != "" {
+		lines, err := loadBaseline(*baselinePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading baseline %s: %v\n", *baselinePath, err)
+			exit(1)
+		}
+		baseline = lines
+	}
+	if *baselineThreshold < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -baseline-threshold must be positive, got %g\n", *baselineThreshold)
+		exit(1)
+	}
+	if *timeout < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -timeout must be positive, got %s\n", *timeout)
+		exit(1)
+	}
+	if *headLines < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -head must be positive, got %d\n", *headLines)
+		exit(1)
+	}
+	if *workers < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -workers must be positive, got %d\n", *workers)
+		exit(1)
+	}
+	numWorkers := *workers
+	if numWorkers == 0 {
+		numWorkers = runtime.NumCPU()
+	}
+
+	skipDirs := splitList(*skipDirsPtr)
+	if *skipNodeModules {
+		skipDirs = append(skipDirs, "node_modules")
+	}
+
 	excludePatterns := strings.Split(*excludePtr, ",")
 	if *excludePtr == "" {
 		excludePatterns = nil
 	}
 
+	// Ctrl-C stops the walk and reports what was counted so far; a second
+	// one kills the process as usual
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	// The deadline stops the scan the same way, at any point in the run
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
 
-	stats := make(map[string]*LanguageStats)
-	var statsMutex sync.Mutex
+	scanOpts := scanner.Options{
+		SkipDirs:         skipDirs,
+		Exclude:          excludePatterns,
+		Include:          splitList(*includePtr),
+		SkipFiles:        outputFiles(*outPath, *saveBaselinePath),
+		Extensions:       extensionList(*extPtr),
+		MaxDepth:         scanMaxDepth(*maxDepth),
+		RespectGitignore: *respectGitignore,
+		FollowSymlinks:   *followSymlinks,
+		StayInRoots:      *readOnly,
+		GitTracked:       *gitTracked,
+		SkipHidden:       *noHidden,
+		SkipDTS:          *noDTS,
+		SkipGenerated:    *skipGenerated,
+		Docs:             *docs,
+		IncludeOther:     *includeOther,
+		SkipShebang:      *listOnly,
+		Languages:        customLanguages,
+		Only:             splitList(*onlyPtr),
+		ModifiedSince:    since,
+		MaxFileSize:      maxFileSize,
+		Workers:          numWorkers,
+		Sample:           *sample,
+		ByDir:            *byDir,
+		KeepFiles:        *showFiles || *maxLinesPerFile > 0,
+		RelativePaths:    *relative,
+		CaseSensitive:    *caseSensitive,
+		Logical:          *logical,
+		Indent:           *indent,
+		HeadLines:        *headLines,
+		Deep:             splitList(*deepPtr),
+		Warn:             scanWarn(logger),
+	}
+	// Counts of unchanged files are reused from the last run
+	if !*noCache && !*listOnly && !*readOnly {
+		if cachePath, err := scanner.DefaultCachePath(rootPaths); err == nil {
+			cache, err := scanner.LoadCache(cachePath)
+			if err != nil {
+				logger.Warn("ignoring cache", "error", err)
+			}
+			scanOpts.Cache = cache
+			logger.Debug("using cache", "path", cachePath)
+		}
+	}
 
-	// channels for the pipeline
-	filesChan := make(chan FileResult, 1000)
-	done := make(chan bool)
+	// Live progress counter on stderr while the scan runs
+	showProgress := !*quiet && isTerminal(os.Stderr)
+	if showProgress {
+		scanOpts.Progress = func(processed int64) {
+			fmt.Fprintf(os.Stderr, "\r⏳ Files processed: %d", processed)
+		}
+	}
 
-	numWorkers := runtime.NumCPU()
+	useColor := !*noColor && *outPath == "" && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
 
-	var wg sync.WaitGroup
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for result := range filesChan {
-				processFile(result.path, result.language, stats, &statsMutex)
+	// Churn mode reads git history instead of the files on disk
+	if *gitChurn != "" {
+		if len(rootPaths) != 1 || *diffMode || *watch || *fromStdin || *listOnly {
+			fmt.Fprintln(os.Stderr, "Error: -git-churn takes a single path and can't be combined with -diff, -watch, -stdin or -list")
+			exit(1)
+		}
+		if format != "table" && format != "json" && format != "csv" {
+			fmt.Fprintf(os.Stderr, "Error: -git-churn supports table, json and csv output, not %s\n", format)
+			exit(1)
+		}
+		out, closeOutput, err := openOutput(*outPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+			exit(1)
+		}
+
+		churn, totals, err := scanner.GitChurn(ctx, rootPaths[0], *gitChurn, scanOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		sortChurn(churn)
+		switch format {
+		case "json":
+			err = printChurnJSON(out, *gitChurn, churn, totals)
+		case "csv":
+			err = printChurnCSV(out, churn, totals)
+		default:
+			printChurnTable(out, rootPaths[0], *gitChurn, churn, totals)
+		}
+		if err == nil {
+			err = closeOutput()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(info, "\n⚡ Execution Time: %.2f seconds\n", time.Since(startTime).Seconds())
+		return
+	}
+
+	// Diff mode scans two trees and reports the change per language
+	if *diffMode {
+		if len(rootPaths) != 2 {
+			fmt.Fprintf(os.Stderr, "Error: -diff needs exactly two paths, got %d\n", len(rootPaths))
+			exit(1)
+		}
+		if format != "table" && format != "json" && format != "csv" {
+			fmt.Fprintf(os.Stderr, "Error: -diff supports table, json and csv output, not %s\n", format)
+			exit(1)
+		}
+		out, closeOutput, err := openOutput(*outPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+			exit(1)
+		}
+
+		var reports [2]scanner.Report
+		for i, root := range rootPaths {
+			reports[i], err = scanner.ScanContext(ctx, []string{root}, scanOpts)
+			if showProgress {
+				fmt.Fprintf(os.Stderr, "\r\033[K")
+			}
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+		}
+		if scanOpts.Cache != nil {
+			// Drop the entries of files deleted since the last run
+			if ctx.Err() == nil {
+				scanOpts.Cache.Prune()
+			}
+			if err := scanOpts.Cache.Save(); err != nil {
+				logger.Warn("can't save cache", "error", err)
 			}
-		}()
+		}
+
+		deltas, totals := diffReports(reports[0], reports[1])
+		switch format {
+		case "json":
+			err = printDiffJSON(out, rootPaths[0], rootPaths[1], deltas, totals)
+		case "csv":
+			err = printDiffCSV(out, deltas, totals)
+		default:
+			printDiffTable(out, rootPaths[0], rootPaths[1], deltas, totals)
+		}
+		if err == nil {
+			err = closeOutput()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			exit(1)
+		}
+
+		fmt.Fprintf(info, "\n⚡ Execution Time: %.2f seconds\n", time.Since(startTime).Seconds())
+		if ctx.Err() != nil {
+			exitPartial(info, ctx.Err(), *timeout)
+		}
+		return
 	}
 
-	go func() {
-		err := filepath.Walk(desktopPath, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
+	runOnce := func() {
+		// Report destination: stdout, or the -o file created/truncated
+		// before the scan so a bad path fails early
+		out, closeOutput, err := openOutput(*outPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+			exit(1)
+		}
+
+		// List mode prints what would be counted without opening any file
+		if *listOnly {
+			paths, err := scanner.ListContext(ctx, rootPaths, scanOpts)
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
 			}
+			for _, path := range paths {
+				fmt.Fprintln(out, path)
+			}
+			if err := closeOutput(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+				exit(1)
+			}
+			return
+		}
 
-			// Skip node_modules directories if flag is set
-			if *skipNodeModules && info.IsDir() && info.Name() == "node_modules" {
-				return filepath.SkipDir
+		// ndjson writes each file from the workers as it is counted
+		opts := scanOpts
+		if format == "ndjson" {
+			enc := json.NewEncoder(out)
+			opts.OnFile = func(file scanner.FileStats) {
+				enc.Encode(ndjsonFile{Type: "file", FileStats: file})
 			}
+		}
+		if *stream {
+			opts.OnFile = streamFiles(os.Stderr, opts.OnFile, showProgress)
+			opts.Progress = nil
+		}
 
-			if info.IsDir() {
-				return nil
+		logger.Debug("scanning", "roots", rootPaths, "workers", numWorkers, "stdin", *fromStdin)
+		var report scanner.Report
+		if *fromStdin {
+			report, err = scanner.ScanFilesContext(ctx, stdinPaths, opts)
+		} else {
+			report, err = scanner.ScanContext(ctx, rootPaths, opts)
+		}
+		if showProgress {
+			fmt.Fprintf(os.Stderr, "\r\033[K")
+		}
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if scanOpts.Cache != nil {
+			// Drop the entries of files deleted since the last run
+			if ctx.Err() == nil {
+				scanOpts.Cache.Prune()
+			}
+			if err := scanOpts.Cache.Save(); err != nil {
+				logger.Warn("can't save cache", "error", err)
 			}
+		}
 
-			// Checking exclude patterns
-			for _, pattern := range excludePatterns {
-				matched, err := filepath.Match(strings.TrimSpace(pattern), filepath.Base(path))
-				if err != nil || matched {
-					return nil
-				}
+		if *saveBaselinePath != "" {
+			if err := saveBaseline(*saveBaselinePath, report); err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving baseline: %v\n", err)
+				exit(1)
 			}
+		}
 
-			ext := strings.ToLower(filepath.Ext(path))
-			if lang, ok := languageExtMap[ext]; ok {
-				filesChan <- FileResult{path: path, language: lang}
+		// -count prints one bare number for scripts and nothing else
+		if countField != "" {
+			total := int64(report.Totals.LineCount)
+			switch countField {
+			case "files":
+				total = int64(report.Totals.FileCount)
+			case "bytes":
+				total = report.Totals.ByteCount
+			}
+			fmt.Fprintln(out, total)
+			if err := closeOutput(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+				exit(1)
+			}
+			if ctx.Err() != nil {
+				exitPartial(io.Discard, ctx.Err(), *timeout)
 			}
-			return nil
+			if *strict && report.Totals.FileCount == 0 {
+				exit(2)
+			}
+			return
+		}
+
+		logger.Debug("scan finished", "files", report.Totals.FileCount, "errors", len(report.Errors), "elapsed", report.ScanTime)
+		reportStart := time.Now()
+		languageData := report.Languages
+		if *byDir {
+			languageData = report.Dirs
+		}
+		if *group {
+			languageData = groupByCategory(languageData)
+		}
+		languageData = applyMergeRules(languageData, mergeRules)
+		sortLanguageData(languageData, sortOpts)
+		if *top > 0 {
+			// Without -sort the name order says nothing about size
+			if len(sortOpts) == 0 {
+				sortLanguageData(languageData, []SortOption{{Field: "lines", Direction: "desc"}})
+			}
+			languageData = keepTop(languageData, *top)
+		}
+		totals := report.Totals
+		perFile := report.Files
+
+		// Largest files first, by path for equal line counts
+		sort.Slice(perFile, func(i, j int) bool {
+			if perFile[i].Stats.LineCount != perFile[j].Stats.LineCount {
+				return perFile[i].Stats.LineCount > perFile[j].Stats.LineCount
+			}
+			return perFile[i].Path < perFile[j].Path
 		})
+		// Already sorted, so the offenders are the leading files
+		var oversized []scanner.FileStats
+		if *maxLinesPerFile > 0 {
+			for _, file := range perFile {
+				if file.Stats.LineCount <= *maxLinesPerFile {
+					break
+				}
+				oversized = append(oversized, file)
+			}
+		}
+		if !*showFiles {
+			perFile = nil
+		}
+		if *topFiles > 0 && len(perFile) > *topFiles {
+			perFile = perFile[:*topFiles]
+		}
+		sortFiles(perFile, filesSort)
 
-		if err != nil {
-			fmt.Printf("Error walking directory: %v\n", err)
+		// Rows before any are hidden, to tell rounding from filtering
+		rowCount := len(languageData)
+		if *minFiles > 0 {
+			shown := languageData[:0]
+			for _, data := range languageData {
+				if data.Stats.FileCount >= *minFiles {
+					shown = append(shown, data)
+				}
+			}
+			languageData = shown
 		}
 
-		close(filesChan)
-	}()
+		// Totals are already computed, so summary mode just drops the rows
+		if *summary {
+			languageData = languageData[:0]
+		}
 
-	wg.Wait()
-	close(done)
+		reportOpts := reportOptions{
+			showPercent: !*noPercent,
+			grouped:     *group,
+			byDir:       *byDir,
+			hideTotal:   *noTotal,
+			human:       *human,
+			logical:     *logical,
+			estimated:   report.Estimated,
+			width:       *width,
+			color:       useColor,
+		}
 
+		title := strings.Join(rootPaths, ", ")
+		if *fromStdin {
+			title = "stdin"
+		} else if *repoURL != "" {
+			title = *repoURL
+		}
 
-	
-	languageData := make([]LanguageData, 0, len(stats))
-	for lang, stat := range stats {
-		languageData = append(languageData, LanguageData{
-			Name:  lang,
-			Stats: *stat,
-		})
+		switch format {
+		case "json":
+			var endings map[string]scanner.LineEndings
+			if *lineEndings {
+				endings = report.LineEndings
+			}
+			if err := printJSON(out, languageData, totals, perFile, endings, report.Other, reportOpts); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+				exit(1)
+			}
+		case "ndjson":
+			if err := printNDJSONSummary(out, languageData, totals); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing NDJSON: %v\n", err)
+				exit(1)
+			}
+		case "csv":
+			if err := printCSV(out, languageData, totals, reportOpts); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing CSV: %v\n", err)
+				exit(1)
+			}
+		case "markdown":
+			printMarkdown(out, languageData, totals, reportOpts)
+		case "prometheus":
+			printPrometheus(out, languageData, totals, reportOpts)
+		case "html":
+			if err := printHTML(out, title, languageData, totals, reportOpts); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing HTML: %v\n", err)
+				exit(1)
+			}
+		default:
+			printTable(out, title, languageData, totals, reportOpts)
+			if *showChart {
+				width := terminalWidth(os.Stdout)
+				if width <= 0 {
+					width = 80
+				}
+				printChart(out, languageData, totals, width)
+			}
+			if *indent {
+				printIndentation(out, languageData, totals)
+			}
+			// Weights are per language, whatever the rows are
+			if *effort {
+				rows, total := computeEffort(report.Languages, effortWeights)
+				printEffort(out, rows, total)
+			}
+			if *lineEndings {
+				printLineEndings(out, report.LineEndings)
+			}
+			if len(report.Other) > 0 {
+				printOtherFiles(out, report.Other, totals, *human)
+			}
+			if *showFiles {
+				printFileList(out, perFile)
+			}
+		}
+		if err := closeOutput(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			exit(1)
+		}
+		reportTime := time.Since(reportStart)
+
+		// Print execution time and configuration
+		elapsed := time.Since(startTime).Seconds()
+		fmt.Fprintf(info, "\n⚡ Execution Time: %.2f seconds\n", elapsed)
+		if elapsed > 0 {
+			fmt.Fprintf(info, "🚀 Throughput: %.0f lines/s, %.0f files/s\n", float64(totals.LineCount)/elapsed, float64(totals.FileCount)/elapsed)
+		}
+		if *profile {
+			fmt.Fprintf(info, "⏱️  Walk: %.3fs (enumerating files, overlaps counting)\n", report.WalkTime.Seconds())
+			fmt.Fprintf(info, "⏱️  Count: %.3fs wall, %.3fs reading across %d workers\n", report.ScanTime.Seconds(), report.ReadTime.Seconds(), numWorkers)
+			fmt.Fprintf(info, "⏱️  Report: %.3fs (sorting and printing)\n", reportTime.Seconds())
+		}
+		if configFile != "" {
+			fmt.Fprintf(info, "⚙️  Config: %s\n", configFile)
+		}
+		if *outPath != "" {
+			fmt.Fprintf(info, "💾 Report written to %s\n", *outPath)
+		}
+		if *saveBaselinePath != "" {
+			fmt.Fprintf(info, "💾 Baseline saved to %s\n", *saveBaselinePath)
+		}
+		if len(sortOpts) > 0 {
+			criteria := make([]string, len(sortOpts))
+			for i, opt := range sortOpts {
+				criteria[i] = fmt.Sprintf("%s (%s)", opt.Field, opt.Direction)
+			}
+			fmt.Fprintf(info, "📊 Sorted by: %s\n", strings.Join(criteria, ", "))
+		}
+		if *skipNodeModules {
+			fmt.Fprintf(info, "🚫 Excluded node_modules directories\n")
+		}
+		if *maxDepth >= 0 {
+			fmt.Fprintf(info, "📏 Max depth: %d\n", *maxDepth)
+		}
+		if *skipDirsPtr != "" {
+			fmt.Fprintf(info, "🚫 Skipped directories: %s\n", strings.Join(splitList(*skipDirsPtr), ", "))
+		}
+		if !since.IsZero() {
+			fmt.Fprintf(info, "🕒 Files modified since %s\n", since.Format("2006-01-02 15:04"))
+		}
+		if maxFileSize > 0 {
+			fmt.Fprintf(info, "🐘 Skipped %d files larger than %s\n", report.SkippedLarge, *maxFileSizePtr)
+		}
+		if *skipGenerated {
+			fmt.Fprintf(info, "🤖 Skipped %d generated files\n", report.SkippedGenerated)
+		}
+		if report.Estimated {
+			fmt.Fprintf(info, "🎲 Estimate: counted a random %d of %d files and scaled up\n", report.SampledFiles, report.MatchedFiles)
+		}
+		if report.UTF16Files > 0 {
+			fmt.Fprintf(info, "🔤 Decoded %d UTF-16 files\n", report.UTF16Files)
+		}
+		if len(report.Errors) > 0 {
+			fmt.Fprintf(info, "⚠️  %d files skipped or incomplete due to errors", len(report.Errors))
+			if !*verbose {
+				fmt.Fprintf(info, " (use -verbose to list them)\n")
+			} else {
+				fmt.Fprintln(info)
+				for _, fileErr := range report.Errors {
+					fmt.Fprintf(info, "   • %s: %v\n", fileErr.Path, fileErr.Err)
+				}
+			}
+		}
+		if *headLines > 0 {
+			fmt.Fprintf(info, "✂️  Counted only the first %d lines of each file\n", *headLines)
+		}
+		if *deepPtr != "" {
+			fmt.Fprintf(info, "🔬 Code/comment/blank split only for: %s (other languages show lines only)\n", strings.Join(splitList(*deepPtr), ", "))
+		}
+		if len(report.DirErrors) > 0 {
+			fmt.Fprintf(info, "🔒 %d directories couldn't be read and were skipped", len(report.DirErrors))
+			if !*verbose {
+				fmt.Fprintf(info, " (use -verbose to list them)\n")
+			} else {
+				fmt.Fprintln(info)
+				for _, dirErr := range report.DirErrors {
+					fmt.Fprintf(info, "   • %s: %v\n", dirErr.Path, dirErr.Err)
+				}
+			}
+		}
+		if *extPtr != "" {
+			fmt.Fprintf(info, "🧩 Only extensions: %s\n", strings.Join(extensionList(*extPtr), ", "))
+		}
+		if *onlyPtr != "" {
+			fmt.Fprintf(info, "🎯 Only counted: %s\n", strings.Join(splitList(*onlyPtr), ", "))
+		}
+		if !*noPercent && (format == "table" || format == "markdown") && len(languageData) == rowCount && totals.FileCount > 0 {
+			lines, size := percentSums(languageData, totals)
+			if fmt.Sprintf("%.1f", lines) != "100.0" || fmt.Sprintf("%.1f", size) != "100.0" {
+				fmt.Fprintf(info, "ℹ️  Percentages are rounded and add up to %.1f%% (lines) and %.1f%% (size)\n", lines, size)
+			}
+		}
+		if *minFiles > 0 {
+			fmt.Fprintf(info, "🙈 Hid languages with fewer than %d files\n", *minFiles)
+		}
+		if *docs {
+			fmt.Fprintf(info, "📝 Included documentation files\n")
+		}
+		if *gitTracked {
+			fmt.Fprintf(info, "🌱 Counted git-tracked files only\n")
+		}
+		if *readOnly {
+			fmt.Fprintf(info, "🔐 Read-only: nothing written below the roots, no cache, no symlinks out\n")
+		}
+		if *respectGitignore {
+			fmt.Fprintf(info, "🚫 Respected .gitignore rules\n")
+		}
+		if *includePtr != "" {
+			fmt.Fprintf(info, "🔎 Only files matching: %s\n", strings.Join(splitList(*includePtr), ", "))
+		}
+		if len(excludePatterns) > 0 {
+			fmt.Fprintln(info, "\n🚫 Excluded Patterns:")
+			for _, pattern := range excludePatterns {
+				if pattern != "" {
+					fmt.Fprintf(info, "   • %s\n", strings.TrimSpace(pattern))
+				}
+			}
+		}
+
+		if ctx.Err() != nil {
+			exitPartial(info, ctx.Err(), *timeout)
+		}
+
+		// Nothing recognised usually means a wrong path; fail CI loudly
+		if *strict && !*watch && totals.FileCount == 0 {
+			fmt.Fprintf(os.Stderr, "Error: no recognised source files found\n")
+			exit(2)
+		}
+		if len(oversized) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: %d files have more than %d lines\n", len(oversized), *maxLinesPerFile)
+			for _, file := range oversized {
+				fmt.Fprintf(os.Stderr, "   • %s: %d lines\n", file.Path, file.Stats.LineCount)
+			}
+			if !*watch {
+				exit(3)
+			}
+		}
+		if baseline != nil {
+			grown := baselineRegressions(baseline, report.Languages, *baselineThreshold)
+			if len(grown) > 0 {
+				fmt.Fprintf(os.Stderr, "Error: %d languages grew more than %g%% over %s\n", len(grown), *baselineThreshold, *baselinePath)
+				for _, growth := range grown {
+					fmt.Fprintf(os.Stderr, "   • %s: %s\n", growth.Name, growth.describe())
+				}
+				if !*watch {
+					exit(4)
+				}
+			}
+		}
 	}
 
-	sortLanguageData(languageData, sortOpt)
+	runOnce()
+	if !*watch {
+		return
+	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.TabIndent)
-	fmt.Fprintf(w, "\n🔍 Code Statistics Report (Desktop Scan)\n\n")
-	fmt.Fprintf(w, "Language\tFiles\tLines\tSize (KB)\t\n")
-	fmt.Fprintf(w, "--------\t-----\t-----\t---------\t\n")
+	// Watch mode: poll for changes and redraw the report after each one
+	fingerprint := treeFingerprint(ctx, rootPaths, scanOpts)
+	for {
+		next, ok := waitForChange(ctx, rootPaths, scanOpts, *watchInterval, fingerprint)
+		if !ok {
+			return
+		}
+		fingerprint = next
+		startTime = time.Now()
+		clearScreen()
+		runOnce()
+	}
+}
 
-	totalFiles := 0
-	totalLines := 0
-	totalSize := int64(0)
+// checkReadOnly refuses what -read-only rules out: writing a file inside
+// a scan root, or following symlinks that may lead out of it
+func checkReadOnly(roots []string, followSymlinks bool, outputs ...string) error {
+	if followSymlinks {
+		return errors.New("can't be combined with -follow-symlinks")
+	}
+	for _, output := range outputs {
+		if output == "" {
+			continue
+		}
+		for _, root := range roots {
+			if insideRoot(output, root) {
+				return fmt.Errorf("won't write %s inside the scan root %s", output, root)
+			}
+		}
+	}
+	return nil
+}
 
-	for _, data := range languageData {
-		totalFiles += data.Stats.FileCount
-		totalLines += data.Stats.LineCount
-		totalSize += data.Stats.ByteCount
-		fmt.Fprintf(w, "%s\t%d\t%d\t%.2f\t\n",
-			data.Name,
-			data.Stats.FileCount,
-			data.Stats.LineCount,
-			float64(data.Stats.ByteCount)/1024,
-		)
+// insideRoot reports whether path is root or below it, after resolving
+// symlinks in both; path itself needn't exist yet
+func insideRoot(path, root string) bool {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		realRoot = root
+	}
+	realRoot, _ = filepath.Abs(realRoot)
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		dir = filepath.Dir(path)
 	}
+	target, _ := filepath.Abs(filepath.Join(dir, filepath.Base(path)))
+	rel, err := filepath.Rel(realRoot, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
 
-	fmt.Fprintf(w, "--------\t-----\t-----\t---------\t\n")
-	fmt.Fprintf(w, "Total\t%d\t%d\t%.2f\t\n",
-		totalFiles,
-		totalLines,
-		float64(totalSize)/1024,
-	)
-	w.Flush()
+// exitPartial notes that the results are partial and exits with 124 when
+// -timeout ran out, as timeout(1) does, or 130 after Ctrl-C
+func exitPartial(info io.Writer, err error, timeout time.Duration) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		fmt.Fprintf(info, "\n⏰ Timed out after %s, results are partial\n", timeout)
+		exit(124)
+	}
+	fmt.Fprintf(info, "\n⚠️  Scan interrupted, results are partial\n")
+	exit(130)
+}
 
-	// Print execution time and configuration
-	fmt.Printf("\n⚡ Execution Time: %.2f seconds\n", time.Since(startTime).Seconds())
-	if sortOpt.Field != "" {
-		fmt.Printf("📊 Sorted by: %s (%s)\n", sortOpt.Field, sortOpt.Direction)
+// extensionList splits -ext into extensions with their leading dot, so
+// "go" and ".go" both work
+func extensionList(value string) []string {
+	exts := splitList(value)
+	for i, ext := range exts {
+		if !strings.HasPrefix(ext, ".") {
+			exts[i] = "." + ext
+		}
 	}
-	if *skipNodeModules {
-		fmt.Printf("🚫 Excluded node_modules directories\n")
+	return exts
+}
+
+// scanMaxDepth turns -max-depth, where 0 is the roots only and a negative
+// value no limit, into scanner.Options.MaxDepth, where 0 is no limit
+func scanMaxDepth(depth int) int {
+	switch {
+	case depth < 0:
+		return 0
+	case depth == 0:
+		return -1
 	}
-	if len(excludePatterns) > 0 {
-		fmt.Println("\n🚫 Excluded Patterns:")
-		for _, pattern := range excludePatterns {
-			if pattern != "" {
-				fmt.Printf("   • %s\n", strings.TrimSpace(pattern))
-			}
+	return depth
+}
+
+// outputFiles are the absolute paths of the files written for paths, which
+// the scan leaves out so a report inside a root isn't counted in itself
+func outputFiles(paths ...string) []string {
+	var files []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			files = append(files, abs)
 		}
 	}
+	return files
 }
 
-func processFile(path, language string, stats map[string]*LanguageStats, statsMutex *sync.Mutex) {
-	file, err := os.Open(path)
+// openOutput returns a buffered writer for the report, on stdout or on a
+// freshly truncated file, and a function that flushes and closes it
+func openOutput(path string) (*bufio.Writer, func() error, error) {
+	if path == "" {
+		out := bufio.NewWriter(os.Stdout)
+		return out, out.Flush, nil
+	}
+
+	f, err := os.Create(path)
 	if err != nil {
-		return
+		return nil, nil, err
 	}
-	defer file.Close()
+	out := bufio.NewWriter(f)
+	return out, func() error {
+		err := out.Flush()
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
 
-	info, err := file.Stat()
+// loadLangMap reads a user supplied extension map, normalised to the
+// ".ext" keys scanner.Options.Languages expects, lower case unless
+// caseSensitive. Entries override built-in mappings for the same extension.
+func loadLangMap(path string, caseSensitive bool) (map[string]string, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return
+		return nil, err
+	}
+
+	var custom map[string]string
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	languages := make(map[string]string, len(custom))
+	for ext, lang := range custom {
+		ext = strings.TrimSpace(ext)
+		if !caseSensitive {
+			ext = strings.ToLower(ext)
+		}
+		if ext == "" || lang == "" {
+			return nil, fmt.Errorf("empty extension or language in entry %q: %q", ext, lang)
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		languages[ext] = lang
+	}
+	return languages, nil
+}
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// parseSize reads a size such as "500KB", "2mb" or "1024". Units are
+// binary, so 1KB is 1024 bytes.
+func parseSize(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+		{"B", 1},
+	}
+
+	number := strings.ToUpper(strings.TrimSpace(value))
+	scale := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix))
+			scale = unit.scale
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size", value)
+	}
+	return int64(n * float64(scale)), nil
+}
+
+// parseSince turns a -since value into a cutoff time: either a window
+// back from now ("90m", "7d", "2w") or an absolute date.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
 	}
 
-	scanner := bufio.NewScanner(file)
-	lineCount := 0
-	for scanner.Scan() {
-		lineCount++
+	// time.ParseDuration stops at hours; days and weeks are added here
+	days := map[string]int{"d": 1, "w": 7}
+	for suffix, scale := range days {
+		if strings.HasSuffix(value, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(value, suffix))
+			if err != nil || n < 0 {
+				break
+			}
+			return now.AddDate(0, 0, -n*scale), nil
+		}
 	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a duration like 7d nor a date", value)
+}
 
-	statsMutex.Lock()
-	if _, exists := stats[language]; !exists {
-		stats[language] = &LanguageStats{}
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	stats[language].FileCount++
-	stats[language].LineCount += lineCount
-	stats[language].ByteCount += info.Size()
-	statsMutex.Unlock()
+	return items
 }
 
-func sortLanguageData(data []LanguageData, opt SortOption) {
+// sortLanguageData orders by each criterion in turn, falling back to the
+// language name so ties always come out the same way.
+func sortLanguageData(data []scanner.LanguageData, opts []SortOption) {
 	sort.Slice(data, func(i, j int) bool {
-		var comparison bool
-		switch opt.Field {
-		case "files":
-			comparison = data[i].Stats.FileCount < data[j].Stats.FileCount
-		case "lines":
-			comparison = data[i].Stats.LineCount < data[j].Stats.LineCount
-		case "size":
-			comparison = data[i].Stats.ByteCount < data[j].Stats.ByteCount
-		default:
-			// Default sort by language name
-			comparison = data[i].Name < data[j].Name
+		for _, opt := range opts {
+			comparison := compareLanguageData(data[i], data[j], opt.Field)
+			if comparison == 0 {
+				continue
+			}
+
+			// Reverse for descending order
+			if opt.Direction == "desc" {
+				comparison = -comparison
+			}
+			return comparison < 0
 		}
+		return data[i].Name < data[j].Name
+	})
+}
+
+// validFilesSortFields are the fields compareFiles knows
+var validFilesSortFields = map[string]bool{"language": true, "lines": true, "code": true, "size": true, "path": true}
 
-		// Reverse for descending order
-		if opt.Direction == "desc" {
-			comparison = !comparison
+// parseSortCriteria reads comma-separated sort criteria, each a field
+// with an optional direction as "lines desc" or "lines:desc"; asc when
+// left out. Only the shape is checked here, see sortProblem.
+func parseSortCriteria(value string) ([]SortOption, error) {
+	var opts []SortOption
+	for _, criterion := range splitList(value) {
+		var parts []string
+		if field, direction, ok := strings.Cut(criterion, ":"); ok {
+			if len(strings.Fields(field)) != 1 || len(strings.Fields(direction)) != 1 || strings.Contains(direction, ":") {
+				return nil, fmt.Errorf("%q should look like 'lines:desc'", criterion)
+			}
+			parts = []string{strings.TrimSpace(field), strings.TrimSpace(direction)}
+		} else {
+			parts = strings.Fields(criterion)
+			if len(parts) > 2 {
+				return nil, fmt.Errorf("%q should be a field and an optional direction, e.g. 'lines desc'", criterion)
+			}
 		}
-		return comparison
+		opt := SortOption{Field: strings.ToLower(parts[0]), Direction: "asc"}
+		if len(parts) == 2 {
+			opt.Direction = strings.ToLower(parts[1])
+		}
+		opts = append(opts, opt)
+	}
+	return opts, nil
+}
+
+// sortProblem describes what's wrong with a well-formed criterion whose
+// field isn't in valid or whose direction isn't asc or desc, "" if nothing
+func sortProblem(opt SortOption, valid map[string]bool) string {
+	switch {
+	case !valid[opt.Field]:
+		return fmt.Sprintf("unknown sort field %q (expected %s)", opt.Field, fieldNames(valid))
+	case opt.Direction != "asc" && opt.Direction != "desc":
+		return fmt.Sprintf("unknown sort direction %q (expected asc or desc)", opt.Direction)
+	}
+	return ""
+}
+
+// fieldNames lists the valid sort fields for error messages
+func fieldNames(valid map[string]bool) string {
+	names := make([]string, 0, len(valid))
+	for name := range valid {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// sortFiles orders the -files listing by each criterion in turn, then by
+// path; without criteria the order is left alone
+func sortFiles(files []scanner.FileStats, opts []SortOption) {
+	if len(opts) == 0 {
+		return
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		for _, opt := range opts {
+			comparison := compareFiles(files[i], files[j], opt.Field)
+			if comparison == 0 {
+				continue
+			}
+			if opt.Direction == "desc" {
+				comparison = -comparison
+			}
+			return comparison < 0
+		}
+		return files[i].Path < files[j].Path
 	})
-}
\ No newline at end of file
+}
+
+// compareFiles returns -1, 0 or 1 comparing a and b on field
+func compareFiles(a, b scanner.FileStats, field string) int {
+	var x, y int64
+	switch field {
+	case "language":
+		return strings.Compare(a.Language, b.Language)
+	case "path":
+		return strings.Compare(a.Path, b.Path)
+	case "lines":
+		x, y = int64(a.Stats.LineCount), int64(b.Stats.LineCount)
+	case "code":
+		x, y = int64(a.Stats.CodeLines), int64(b.Stats.CodeLines)
+	case "size":
+		x, y = a.Stats.ByteCount, b.Stats.ByteCount
+	}
+
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// compareLanguageData returns -1, 0 or 1 comparing a and b on field
+func compareLanguageData(a, b scanner.LanguageData, field string) int {
+	var x, y int64
+	switch field {
+	case "files":
+		x, y = int64(a.Stats.FileCount), int64(b.Stats.FileCount)
+	case "lines":
+		x, y = int64(a.Stats.LineCount), int64(b.Stats.LineCount)
+	case "size":
+		x, y = a.Stats.ByteCount, b.Stats.ByteCount
+	default:
+		// "name", and the fallback once the criteria tie
+		return strings.Compare(a.Name, b.Name)
+	}
+
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
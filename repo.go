@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// cleanups run, last first, when main returns or calls exit
+var cleanups []func()
+
+// runCleanups runs and forgets the registered cleanups
+func runCleanups() {
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+	cleanups = nil
+}
+
+// exit is os.Exit after the cleanups, so a -repo clone isn't left behind
+func exit(code int) {
+	runCleanups()
+	os.Exit(code)
+}
+
+// cloneRepo shallow-clones url into a fresh temporary directory, removed
+// again by runCleanups. Ctrl-C stops the clone.
+func cloneRepo(url string) (string, error) {
+	dir, err := os.MkdirTemp("", "tokie-repo-")
+	if err != nil {
+		return "", err
+	}
+	cleanups = append(cleanups, func() { os.RemoveAll(dir) })
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "clone", "--depth", "1", "--quiet", "--", url, dir)
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("clone interrupted")
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%v: %s", err, msg)
+		}
+		return "", err
+	}
+	return dir, nil
+}
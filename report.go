@@ -0,0 +1,567 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mrinalxdev/cli-code/scanner"
+)
+
+// reportOptions toggles optional parts of the table report
+type reportOptions struct {
+	showPercent bool
+	color       bool
+	// grouped rows are categories rather than languages
+	grouped bool
+	// byDir rows are top-level directories
+	byDir bool
+	// hideTotal leaves out the totals row
+	hideTotal bool
+	// human renders sizes with adaptive units instead of always KB
+	human bool
+	// logical adds the -logical statement counts after Code
+	logical bool
+	// estimated marks counts scaled up from a -sample
+	estimated bool
+	// width fixes every table column to this many characters instead of
+	// fitting them to the data; 0 fits them
+	width int
+}
+
+// printTable writes the human readable report
+func printTable(out io.Writer, title string, languageData []scanner.LanguageData, totals scanner.LanguageStats, opts reportOptions) {
+	if opts.estimated {
+		title += ", estimated from a sample"
+	}
+	fmt.Fprintf(out, "\n🔍 Code Statistics Report (%s)\n\n", title)
+
+	// Lay the table out uncoloured first; escape codes would otherwise
+	// count towards the tabwriter's column widths
+	var buf bytes.Buffer
+	w := newTableWriter(&buf, opts.width)
+
+	headers := tableHeaders(opts)
+	separators := make([]string, len(headers))
+	for i, header := range headers {
+		separators[i] = strings.Repeat("-", len(header))
+	}
+
+	printTableLine(w, headers)
+	printTableLine(w, separators)
+	for _, data := range languageData {
+		printTableLine(w, tableRow(data.Name, data.Stats, totals, opts))
+	}
+	if !opts.hideTotal {
+		if len(languageData) > 0 {
+			printTableLine(w, separators)
+		}
+		printTableLine(w, tableRow("Total", totals, totals, opts))
+	}
+	w.Flush()
+
+	if !opts.color {
+		out.Write(buf.Bytes())
+		return
+	}
+
+	// Highlight the header, the language with the most lines and the totals
+	topRow := -1
+	for i, data := range languageData {
+		if topRow < 0 || data.Stats.LineCount > languageData[topRow].Stats.LineCount {
+			topRow = i
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			line = colorize(line, ansiBold)
+		case topRow >= 0 && i == topRow+2:
+			line = colorize(line, ansiGreen)
+		case !opts.hideTotal && i == len(lines)-1:
+			line = colorize(line, ansiBold)
+		}
+		fmt.Fprintln(out, line)
+	}
+}
+
+// tableWriter lays out tab-separated cells, one row per line
+type tableWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// newTableWriter returns a tabwriter, or with width > 0 a writer that
+// pads every cell to that width so columns don't move between runs
+func newTableWriter(out io.Writer, width int) tableWriter {
+	if width > 0 {
+		return &fixedWidthWriter{out: out, width: width}
+	}
+	return tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.TabIndent)
+}
+
+// fixedWidthWriter is the -width alternative to tabwriter. Cells longer
+// than the width aren't cut, they push the rest of their row right.
+type fixedWidthWriter struct {
+	out     io.Writer
+	width   int
+	pending []byte
+}
+
+func (w *fixedWidthWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		end := bytes.IndexByte(w.pending, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		if err := w.writeRow(string(w.pending[:end])); err != nil {
+			return 0, err
+		}
+		w.pending = w.pending[end+1:]
+	}
+}
+
+func (w *fixedWidthWriter) writeRow(row string) error {
+	var line strings.Builder
+	for _, cell := range strings.Split(strings.TrimSuffix(row, "\t"), "\t") {
+		fmt.Fprintf(&line, "%-*s ", w.width, cell)
+	}
+	_, err := fmt.Fprintln(w.out, line.String())
+	return err
+}
+
+// Flush writes a final row that had no newline
+func (w *fixedWidthWriter) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	row := string(w.pending)
+	w.pending = nil
+	return w.writeRow(row)
+}
+
+func tableHeaders(opts reportOptions) []string {
+	first := "Language"
+	if opts.grouped {
+		first = "Category"
+	} else if opts.byDir {
+		first = "Directory"
+	}
+	headers := []string{first, "Files", "Lines", "Code", "Comments", "Blanks", "Comment %", "Lines/File", "Size (KB)", "Avg (KB)", "Max (KB)"}
+	if opts.human {
+		headers[8], headers[9], headers[10] = "Size", "Avg", "Max"
+	}
+	if opts.logical {
+		headers = insertColumn(headers, 4, "Logical")
+	}
+	if opts.showPercent {
+		headers = append(headers, "Lines %", "Size %")
+	}
+	return headers
+}
+
+// Eighth-block characters for sub-cell bar precision
+var barEighths = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+
+// printChart draws each language's share of total lines as a horizontal
+// bar, where a full-width bar would be 100%
+func printChart(out io.Writer, languageData []scanner.LanguageData, totals scanner.LanguageStats, width int) {
+	nameWidth := 0
+	for _, data := range languageData {
+		if len(data.Name) > nameWidth {
+			nameWidth = len(data.Name)
+		}
+	}
+
+	// name, two spaces, bar, space, "100.0%"
+	barWidth := width - nameWidth - 2 - 7
+	if barWidth < 10 {
+		barWidth = 10
+	}
+
+	fmt.Fprintf(out, "\n📊 Share of lines\n\n")
+	for _, data := range languageData {
+		share := 0.0
+		if totals.LineCount > 0 {
+			share = float64(data.Stats.LineCount) / float64(totals.LineCount)
+		}
+		eighths := int(share*float64(barWidth*8) + 0.5)
+		bar := strings.Repeat("█", eighths/8) + barEighths[eighths%8]
+		fmt.Fprintf(out, "%-*s  %s %.1f%%\n", nameWidth, data.Name, bar, share*100)
+	}
+}
+
+// printMarkdown writes the table report as a GitHub-flavored Markdown
+// table, padded so the raw text lines up as well
+func printMarkdown(out io.Writer, languageData []scanner.LanguageData, totals scanner.LanguageStats, opts reportOptions) {
+	rows := [][]string{tableHeaders(opts)}
+	for _, data := range languageData {
+		rows = append(rows, tableRow(data.Name, data.Stats, totals, opts))
+	}
+	if !opts.hideTotal {
+		totalRow := tableRow("Total", totals, totals, opts)
+		for i := range totalRow {
+			totalRow[i] = "**" + totalRow[i] + "**"
+		}
+		rows = append(rows, totalRow)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			row[i] = escapeMarkdownCell(cell)
+		}
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+	for i := range widths {
+		if widths[i] < 3 {
+			widths[i] = 3
+		}
+	}
+
+	for r, row := range rows {
+		printMarkdownRow(out, row, widths)
+		if r == 0 {
+			// Language column left aligned, numbers right aligned
+			separators := make([]string, len(widths))
+			for i, width := range widths {
+				if i == 0 {
+					separators[i] = strings.Repeat("-", width)
+				} else {
+					separators[i] = strings.Repeat("-", width-1) + ":"
+				}
+			}
+			printMarkdownRow(out, separators, widths)
+		}
+	}
+}
+
+func printMarkdownRow(out io.Writer, cells []string, widths []int) {
+	padded := make([]string, len(cells))
+	for i, cell := range cells {
+		if i == 0 {
+			padded[i] = fmt.Sprintf("%-*s", widths[i], cell)
+		} else {
+			padded[i] = fmt.Sprintf("%*s", widths[i], cell)
+		}
+	}
+	fmt.Fprintf(out, "| %s |\n", strings.Join(padded, " | "))
+}
+
+// escapeMarkdownCell keeps a -merge bucket or directory name from
+// breaking the table: pipes are escaped and line breaks become spaces
+var escapeMarkdownCell = strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ", "\r", " ").Replace
+
+func printTableLine(w io.Writer, cells []string) {
+	fmt.Fprintf(w, "%s\t\n", strings.Join(cells, "\t"))
+}
+
+func tableRow(name string, stats, totals scanner.LanguageStats, opts reportOptions) []string {
+	row := []string{
+		name,
+		strconv.Itoa(stats.FileCount),
+		strconv.Itoa(stats.LineCount),
+		strconv.Itoa(stats.CodeLines),
+		strconv.Itoa(stats.CommentLines),
+		strconv.Itoa(stats.BlankLines),
+		fmt.Sprintf("%.1f%%", stats.CommentDensity()),
+		fmt.Sprintf("%.1f", stats.AvgLines()),
+		formatSize(float64(stats.ByteCount), opts.human),
+		formatSize(stats.AvgBytes(), opts.human),
+		formatSize(float64(stats.MaxBytes), opts.human),
+	}
+	if opts.logical {
+		row = insertColumn(row, 4, strconv.Itoa(stats.LogicalLines))
+	}
+	if opts.showPercent {
+		row = append(row,
+			formatPercent(int64(stats.LineCount), int64(totals.LineCount)),
+			formatPercent(stats.ByteCount, totals.ByteCount),
+		)
+	}
+	return row
+}
+
+// insertColumn puts cell at index i of a row, shifting the rest right
+func insertColumn(row []string, i int, cell string) []string {
+	row = append(row, "")
+	copy(row[i+1:], row[i:])
+	row[i] = cell
+	return row
+}
+
+// formatSize renders a byte count as plain KB, or with -human in the
+// largest unit that keeps the number at least 1
+func formatSize(bytes float64, human bool) string {
+	if !human {
+		return fmt.Sprintf("%.2f", bytes/1024)
+	}
+	if bytes < 1024 {
+		return fmt.Sprintf("%.0f B", bytes)
+	}
+	units := []string{"KB", "MB", "GB", "TB"}
+	value := bytes / 1024
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.2f %s", value, units[unit])
+}
+
+// percentSums adds up the rounded line and size shares of the rows as
+// displayed, which can miss 100% by a tenth or so
+func percentSums(languageData []scanner.LanguageData, totals scanner.LanguageStats) (lines, size float64) {
+	for _, data := range languageData {
+		share, _ := strconv.ParseFloat(strings.TrimSuffix(formatPercent(int64(data.Stats.LineCount), int64(totals.LineCount)), "%"), 64)
+		lines += share
+		share, _ = strconv.ParseFloat(strings.TrimSuffix(formatPercent(data.Stats.ByteCount, totals.ByteCount), "%"), 64)
+		size += share
+	}
+	return lines, size
+}
+
+// formatPercent renders part as a share of whole, 0% when whole is empty
+func formatPercent(part, whole int64) string {
+	if whole == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(part)*100/float64(whole))
+}
+
+// printLineEndings writes how many files of each language use LF, CRLF
+// or both, by language name
+func printLineEndings(out io.Writer, endings map[string]scanner.LineEndings) {
+	names := make([]string, 0, len(endings))
+	for name := range endings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.TabIndent)
+	fmt.Fprintf(w, "\n↩️  Line Endings\n\n")
+	printTableLine(w, []string{"Language", "LF", "CRLF", "Mixed"})
+	printTableLine(w, []string{"--------", "--", "----", "-----"})
+	for _, name := range names {
+		e := endings[name]
+		printTableLine(w, []string{name, strconv.Itoa(e.LF), strconv.Itoa(e.CRLF), strconv.Itoa(e.Mixed)})
+	}
+	w.Flush()
+}
+
+// printOtherFiles writes the -include-other files by extension, largest
+// first, with their share of the bytes both they and the code take up
+func printOtherFiles(out io.Writer, other []scanner.LanguageData, totals scanner.LanguageStats, human bool) {
+	other = append([]scanner.LanguageData(nil), other...)
+	sort.SliceStable(other, func(i, j int) bool { return other[i].Stats.ByteCount > other[j].Stats.ByteCount })
+	allBytes := totals.ByteCount
+	for _, data := range other {
+		allBytes += data.Stats.ByteCount
+	}
+
+	sizeHeader := "Size (KB)"
+	if human {
+		sizeHeader = "Size"
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.TabIndent)
+	fmt.Fprintf(w, "\n📦 Other Files\n\n")
+	printTableLine(w, []string{"Extension", "Files", sizeHeader, "Disk %"})
+	printTableLine(w, []string{"---------", "-----", strings.Repeat("-", len(sizeHeader)), "------"})
+	for _, data := range other {
+		printTableLine(w, []string{
+			data.Name,
+			strconv.Itoa(data.Stats.FileCount),
+			formatSize(float64(data.Stats.ByteCount), human),
+			formatPercent(data.Stats.ByteCount, allBytes),
+		})
+	}
+	w.Flush()
+}
+
+// printIndentation writes how many non-blank lines of each row start
+// with a tab and how many with a space
+func printIndentation(out io.Writer, languageData []scanner.LanguageData, totals scanner.LanguageStats) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.TabIndent)
+	fmt.Fprintf(w, "\n📐 Indentation\n\n")
+	printTableLine(w, []string{"Language", "Tabs", "Spaces", "Tabs %"})
+	printTableLine(w, []string{"--------", "----", "------", "------"})
+	row := func(name string, stats scanner.LanguageStats) []string {
+		return []string{
+			name,
+			strconv.Itoa(stats.TabIndented),
+			strconv.Itoa(stats.SpaceIndented),
+			formatPercent(int64(stats.TabIndented), int64(stats.TabIndented+stats.SpaceIndented)),
+		}
+	}
+	for _, data := range languageData {
+		printTableLine(w, row(data.Name, data.Stats))
+	}
+	printTableLine(w, row("Total", totals))
+	w.Flush()
+}
+
+// printFileList writes the per-file listing in the order given
+func printFileList(out io.Writer, files []scanner.FileStats) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.TabIndent)
+	fmt.Fprintf(w, "\n📄 Files\n\n")
+	printTableLine(w, []string{"Lines", "Language", "File"})
+	printTableLine(w, []string{"-----", "--------", "----"})
+	for _, file := range files {
+		printTableLine(w, []string{strconv.Itoa(file.Stats.LineCount), file.Language, file.Path})
+	}
+	w.Flush()
+}
+
+type jsonReport struct {
+	Estimated bool                   `json:"estimated,omitempty"`
+	Languages []scanner.LanguageData `json:"languages"`
+	Totals    *scanner.LanguageStats `json:"totals,omitempty"`
+	Files     []scanner.FileStats    `json:"files,omitempty"`
+	// LineEndings is only filled in with -line-endings
+	LineEndings map[string]scanner.LineEndings `json:"line_endings,omitempty"`
+	// Other is only filled in with -include-other
+	Other []scanner.LanguageData `json:"other,omitempty"`
+}
+
+// printJSON writes the report as a single indented JSON document
+func printJSON(out io.Writer, languageData []scanner.LanguageData, totals scanner.LanguageStats, files []scanner.FileStats, lineEndings map[string]scanner.LineEndings, other []scanner.LanguageData, opts reportOptions) error {
+	report := jsonReport{Estimated: opts.estimated, Languages: languageData, Files: files, LineEndings: lineEndings, Other: other}
+	if !opts.hideTotal {
+		report.Totals = &totals
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// ndjsonFile is one line of -format ndjson output per counted file
+type ndjsonFile struct {
+	Type string `json:"type"`
+	scanner.FileStats
+}
+
+type ndjsonSummary struct {
+	Type      string                 `json:"type"`
+	Languages []scanner.LanguageData `json:"languages"`
+	Totals    scanner.LanguageStats  `json:"totals"`
+}
+
+// printNDJSONSummary writes the closing line of -format ndjson output,
+// after the per-file lines streamed during the scan
+func printNDJSONSummary(out io.Writer, languageData []scanner.LanguageData, totals scanner.LanguageStats) error {
+	return json.NewEncoder(out).Encode(ndjsonSummary{Type: "summary", Languages: languageData, Totals: totals})
+}
+
+// printCSV writes one row per language followed by a totals row
+func printCSV(out io.Writer, languageData []scanner.LanguageData, totals scanner.LanguageStats, opts reportOptions) error {
+	w := csv.NewWriter(out)
+	first := "language"
+	if opts.grouped {
+		first = "group"
+	} else if opts.byDir {
+		first = "dir"
+	}
+	header := []string{first, "files", "lines", "code", "comments", "blanks", "comment_pct", "avg_lines", "size_bytes", "avg_bytes", "max_bytes"}
+	if opts.logical {
+		header = insertColumn(header, 4, "logical")
+	}
+	w.Write(header)
+	for _, data := range languageData {
+		w.Write(csvRow(data.Name, data.Stats, opts))
+	}
+	if !opts.hideTotal {
+		w.Write(csvRow("Total", totals, opts))
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func csvRow(name string, stats scanner.LanguageStats, opts reportOptions) []string {
+	row := []string{
+		name,
+		strconv.Itoa(stats.FileCount),
+		strconv.Itoa(stats.LineCount),
+		strconv.Itoa(stats.CodeLines),
+		strconv.Itoa(stats.CommentLines),
+		strconv.Itoa(stats.BlankLines),
+		strconv.FormatFloat(stats.CommentDensity(), 'f', 2, 64),
+		strconv.FormatFloat(stats.AvgLines(), 'f', 2, 64),
+		strconv.FormatInt(stats.ByteCount, 10),
+		strconv.FormatFloat(stats.AvgBytes(), 'f', 2, 64),
+		strconv.FormatInt(stats.MaxBytes, 10),
+	}
+	if opts.logical {
+		row = insertColumn(row, 4, strconv.Itoa(stats.LogicalLines))
+	}
+	return row
+}
+
+// prometheusMetrics are the per-language series of -format prometheus
+var prometheusMetrics = []struct {
+	name, help string
+	value      func(scanner.LanguageStats) int64
+}{
+	{"tokie_files", "Files counted", func(s scanner.LanguageStats) int64 { return int64(s.FileCount) }},
+	{"tokie_lines", "Lines counted", func(s scanner.LanguageStats) int64 { return int64(s.LineCount) }},
+	{"tokie_code_lines", "Code lines counted", func(s scanner.LanguageStats) int64 { return int64(s.CodeLines) }},
+	{"tokie_comment_lines", "Comment lines counted", func(s scanner.LanguageStats) int64 { return int64(s.CommentLines) }},
+	{"tokie_blank_lines", "Blank lines counted", func(s scanner.LanguageStats) int64 { return int64(s.BlankLines) }},
+	{"tokie_bytes", "Bytes counted", func(s scanner.LanguageStats) int64 { return s.ByteCount }},
+}
+
+// printPrometheus writes the report in the Prometheus text exposition
+// format, for the node exporter's textfile collector. Each metric has a
+// series per language; the totals are a separate "_all" metric, so
+// summing a metric over its labels doesn't count everything twice.
+func printPrometheus(out io.Writer, languageData []scanner.LanguageData, totals scanner.LanguageStats, opts reportOptions) {
+	label := "language"
+	if opts.grouped {
+		label = "category"
+	} else if opts.byDir {
+		label = "directory"
+	}
+	for _, metric := range prometheusMetrics {
+		fmt.Fprintf(out, "# HELP %s %s.\n", metric.name, metric.help)
+		fmt.Fprintf(out, "# TYPE %s gauge\n", metric.name)
+		for _, data := range languageData {
+			fmt.Fprintf(out, "%s{%s=\"%s\"} %d\n", metric.name, label, escapeLabel(data.Name), metric.value(data.Stats))
+		}
+	}
+	if opts.hideTotal {
+		return
+	}
+	for _, metric := range prometheusMetrics {
+		name := metric.name + "_all"
+		fmt.Fprintf(out, "# HELP %s %s in total.\n", name, metric.help)
+		fmt.Fprintf(out, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(out, "%s %d\n", name, metric.value(totals))
+	}
+}
+
+// escapeLabel escapes a label value as the exposition format requires
+var escapeLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
+
+const (
+	ansiReset = "\033[0m"
+	ansiBold  = "\033[1m"
+	ansiGreen = "\033[32m"
+)
+
+// colorize wraps s in an ANSI escape sequence
+func colorize(s, code string) string {
+	return code + s + ansiReset
+}
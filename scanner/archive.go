@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"archive/zip"
+	"path/filepath"
+	"strings"
+)
+
+// isZipPath reports whether path names a zip archive, which is scanned
+// like a directory when given as a root
+func isZipPath(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".zip")
+}
+
+// visitZip sends the entries of the archive at root as if it were a
+// directory, without extracting it. The archive stays open until the
+// scan is done with it. Gitignore and git tracking don't apply.
+func (w *walker) visitZip(root string) {
+	archive, err := zip.OpenReader(root)
+	if err != nil {
+		w.mu.Lock()
+		w.dirErrors = append(w.dirErrors, FileError{Path: root, Err: err})
+		w.mu.Unlock()
+		return
+	}
+	w.archives = append(w.archives, archive)
+
+	for _, entry := range archive.File {
+		if w.ctx.Err() != nil {
+			return
+		}
+		name := strings.TrimPrefix(entry.Name, "./")
+		if entry.FileInfo().IsDir() || !w.zipEntryWanted(name) {
+			continue
+		}
+		if !w.opts.ModifiedSince.IsZero() && entry.Modified.Before(w.opts.ModifiedSince) {
+			continue
+		}
+
+		shebang := func() string {
+			r, err := entry.Open()
+			if err != nil {
+				return ""
+			}
+			defer r.Close()
+			return shebangLanguage(r)
+		}
+		if w.opts.SkipShebang {
+			shebang = nil
+		}
+		lang, ok := w.opts.fileLanguage(name, shebang)
+		if !ok {
+			continue
+		}
+
+		result := fileResult{
+			path:     filepath.Join(root, filepath.FromSlash(name)),
+			relPath:  name,
+			dir:      w.topDir(root, name),
+			language: lang,
+			entry:    entry,
+		}
+		select {
+		case w.files <- result:
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+// closeArchives closes the archives visitZip opened, once nothing reads
+// their entries any more
+func (w *walker) closeArchives() {
+	for _, archive := range w.archives {
+		archive.Close()
+	}
+}
+
+// zipEntryWanted applies the directory filters of the walk to an entry's
+// slash-separated name
+func (w *walker) zipEntryWanted(name string) bool {
+	parts := strings.Split(name, "/")
+	if limit := w.opts.depthLimit(); limit >= 0 && len(parts)-1 > limit {
+		return false
+	}
+	for i, part := range parts {
+		if w.opts.SkipHidden && strings.HasPrefix(part, ".") {
+			return false
+		}
+		if i < len(parts)-1 && matchesAny(w.opts.SkipDirs, part) {
+			return false
+		}
+	}
+	return true
+}
+
+// countEntry is countFile for a file inside a zip archive; archive entries
+// aren't cached
+func countEntry(result fileResult, opts Options) (counted FileStats, ok bool, err error) {
+	counted = FileStats{Path: result.path, Language: result.language}
+	size := int64(result.entry.UncompressedSize64)
+	if opts.MaxFileSize > 0 && size > opts.MaxFileSize {
+		return counted, false, errTooLarge
+	}
+
+	r, err := result.entry.Open()
+	if err != nil {
+		return counted, false, err
+	}
+	defer r.Close()
+
+	counted, ok, err = countContent(counted, r, opts)
+	if !ok {
+		return counted, false, err
+	}
+	counted.Stats.FileCount = 1
+	counted.Stats.ByteCount = size
+	counted.Stats.MaxBytes = size
+	return counted, true, err
+}
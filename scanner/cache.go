@@ -0,0 +1,198 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// cacheVersion is bumped whenever counting rules change, so counts
+// written by an older build are thrown away instead of reused
+const cacheVersion = 5
+
+// cacheEntry is the stored result for one file, valid while the file
+// keeps the same size and modification time
+type cacheEntry struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"`
+	// Language is what the walk assigned and Counted what the file
+	// was counted as; they differ for notebooks
+	Language  string        `json:"language"`
+	Counted   string        `json:"counted"`
+	Stats     LanguageStats `json:"stats"`
+	Encoding  string        `json:"encoding,omitempty"`
+	Ending    string        `json:"ending,omitempty"`
+	Generated bool          `json:"generated,omitempty"`
+	// Logical and Indent record which optional counts were made, Shallow
+	// that only lines were and Head how many, 0 for all
+	Logical bool `json:"logical,omitempty"`
+	Indent  bool `json:"indent,omitempty"`
+	Shallow bool `json:"shallow,omitempty"`
+	Head    int  `json:"head,omitempty"`
+}
+
+type cacheFile struct {
+	Version int                   `json:"version"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+// Cache remembers line counts between runs, keyed by absolute path, so
+// unchanged files aren't read again. It is safe for concurrent use.
+type Cache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// seen holds the keys looked up or stored since loading, which Prune keeps
+	seen  map[string]bool
+	dirty bool
+}
+
+// DefaultCachePath is the cache file under the user's cache directory for
+// scans of roots. Each set of roots gets its own file, so a run loads and
+// rewrites only the counts of the trees it scans.
+func DefaultCachePath(roots []string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	keys := make([]string, 0, len(roots))
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return "", err
+		}
+		keys = append(keys, abs)
+	}
+	sort.Strings(keys)
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\x00")))
+	return filepath.Join(dir, "tokie", "cache-"+hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// LoadCache reads the cache stored at path. A missing file gives an empty
+// cache; so does an unreadable one, which is reported in the error while
+// the returned cache is still usable and will overwrite it on Save.
+func LoadCache(path string) (*Cache, error) {
+	c := &Cache{path: path, entries: make(map[string]cacheEntry), seen: make(map[string]bool)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	var stored cacheFile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return c, fmt.Errorf("corrupt cache %s: %w", path, err)
+	}
+	if stored.Version == cacheVersion && stored.Entries != nil {
+		c.entries = stored.Entries
+	}
+	return c, nil
+}
+
+// Prune drops the entries of deleted or renamed files. Only entries not
+// looked up or stored since the cache was loaded are checked, so files a
+// filtered or sampled run skipped keep their counts for the next one.
+func (c *Cache) Prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if c.seen[key] {
+			continue
+		}
+		if _, err := os.Lstat(key); errors.Is(err, fs.ErrNotExist) {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+}
+
+// Save writes the cache back if anything changed. The file is replaced
+// atomically so a concurrent run never sees half of it.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(cacheFile{Version: cacheVersion, Entries: c.entries})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".cache-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// lookup returns the stored counts for path if it hasn't changed since
+func (c *Cache) lookup(path, language string, mode countMode, info os.FileInfo) (FileStats, bool) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return FileStats{}, false
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.seen[key] = true
+	c.mu.Unlock()
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() || entry.Language != language || entry.Logical != mode.logical || entry.Indent != mode.indent || entry.Shallow != mode.shallow || entry.Head != mode.head {
+		return FileStats{}, false
+	}
+	return FileStats{Path: path, Language: entry.Counted, Stats: entry.Stats, Encoding: entry.Encoding, LineEnding: entry.Ending, Generated: entry.Generated}, true
+}
+
+// store records the counts for path, replacing any stale entry
+func (c *Cache) store(path, language string, mode countMode, info os.FileInfo, counted FileStats) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.entries[key] = cacheEntry{
+		Size:      info.Size(),
+		ModTime:   info.ModTime().UnixNano(),
+		Language:  language,
+		Counted:   counted.Language,
+		Stats:     counted.Stats,
+		Encoding:  counted.Encoding,
+		Ending:    counted.LineEnding,
+		Generated: counted.Generated,
+		Logical:   mode.logical,
+		Indent:    mode.indent,
+		Shallow:   mode.shallow,
+		Head:      mode.head,
+	}
+	c.seen[key] = true
+	c.dirty = true
+	c.mu.Unlock()
+}
@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A file deleted between runs leaves the cache, one a filtered run skips
+// stays, and a run that changes nothing doesn't rewrite it
+func TestCachePrune(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "src")
+	if err := os.Mkdir(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"keep.go", "gone.go"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("package src\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cachePath := filepath.Join(dir, "cache.json")
+
+	scan := func(exclude ...string) *Cache {
+		cache, err := LoadCache(cachePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := DefaultOptions()
+		opts.Cache = cache
+		opts.Exclude = exclude
+		if _, err := Scan([]string{root}, opts); err != nil {
+			t.Fatal(err)
+		}
+		cache.Prune()
+		if err := cache.Save(); err != nil {
+			t.Fatal(err)
+		}
+		return cache
+	}
+
+	if cache := scan(); len(cache.entries) != 2 {
+		t.Fatalf("first scan cached %d files, want 2", len(cache.entries))
+	}
+	if err := os.Remove(filepath.Join(root, "gone.go")); err != nil {
+		t.Fatal(err)
+	}
+	if cache := scan(); len(cache.entries) != 1 {
+		t.Fatalf("after a delete the cache holds %d files, want 1", len(cache.entries))
+	}
+	if cache := scan("keep.go"); len(cache.entries) != 1 {
+		t.Fatalf("after a filtered scan the cache holds %d files, want 1", len(cache.entries))
+	}
+
+	info, err := os.Stat(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan()
+	after, err := os.Stat(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.ModTime().Equal(info.ModTime()) {
+		t.Error("an unchanged scan rewrote the cache")
+	}
+}
@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChurnStats are the lines git recorded as added and removed
+type ChurnStats struct {
+	// Changes counts file changes across all commits, so a file edited
+	// in three commits is three changes
+	Changes int `json:"changes"`
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// ChurnData pairs a language name with its churn
+type ChurnData struct {
+	Name  string     `json:"language"`
+	Stats ChurnStats `json:"stats"`
+}
+
+// GitChurn adds up, per language, the lines added and removed by the
+// commits in revRange (e.g. "v1.0..HEAD") that touch files below root,
+// from git log --numstat. Files are filtered and named as in a scan,
+// except that shebang detection and file metadata don't apply: the
+// files may no longer exist. Binary changes are left out.
+func GitChurn(ctx context.Context, root, revRange string, opts Options) ([]ChurnData, ChurnStats, error) {
+	args := []string{"-C", root, "log", "--numstat", "--format=", "--relative", "-z"}
+	if revRange != "" {
+		args = append(args, revRange)
+	}
+	args = append(args, "--")
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, ChurnStats{}, fmt.Errorf("git log: %v: %s", err, msg)
+		}
+		return nil, ChurnStats{}, fmt.Errorf("git log: %w", err)
+	}
+
+	byLanguage := make(map[string]*ChurnStats)
+	var totals ChurnStats
+	records := strings.Split(string(out), "\x00")
+	for i := 0; i < len(records); i++ {
+		fields := strings.SplitN(strings.TrimLeft(records[i], "\n"), "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		path := fields[2]
+		// A rename leaves the path empty and puts old and new path in
+		// the next two records
+		if path == "" && i+2 < len(records) {
+			path = records[i+2]
+			i += 2
+		}
+		added, errAdded := strconv.Atoi(fields[0])
+		removed, errRemoved := strconv.Atoi(fields[1])
+		if errAdded != nil || errRemoved != nil {
+			continue
+		}
+		if inSkippedDir(path, opts.SkipDirs) {
+			continue
+		}
+		// Notebooks keep their own name; their kernel isn't known here
+		lang, ok := opts.fileLanguage(path, nil)
+		if !ok || lang == otherLanguage || !opts.allowsLanguage(lang) {
+			continue
+		}
+
+		if _, exists := byLanguage[lang]; !exists {
+			byLanguage[lang] = &ChurnStats{}
+		}
+		for _, stats := range []*ChurnStats{byLanguage[lang], &totals} {
+			stats.Changes++
+			stats.Added += added
+			stats.Removed += removed
+		}
+	}
+
+	data := make([]ChurnData, 0, len(byLanguage))
+	for lang, stats := range byLanguage {
+		data = append(data, ChurnData{Name: lang, Stats: *stats})
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].Name < data[j].Name })
+	return data, totals, nil
+}
+
+// inSkippedDir reports whether a slash separated path goes through a
+// directory matched by one of the SkipDirs patterns
+func inSkippedDir(path string, skipDirs []string) bool {
+	dirs := strings.Split(path, "/")
+	for _, dir := range dirs[:len(dirs)-1] {
+		if matchesAny(skipDirs, dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package scanner
+
+import (
+	"bytes"
+	"io"
+)
+
+type lineKind int
+
+const (
+	lineCode lineKind = iota
+	lineComment
+	lineBlank
+)
+
+// countChunkSize is how much of a file is read at a time
+const countChunkSize = 32 * 1024
+
+// countLines tallies the lines read from r, logical lines too when
+// logical is set and tab/space indented lines with indent, and names the
+// file's line ending. A line is any run of bytes
+// terminated by "\n", plus a final run that has no terminator. So "a\nb\n"
+// and "a\nb" are both two lines, "\n" is a single blank line and an empty
+// file has no lines at all.
+//
+// The input is read in fixed-size chunks and line ends are found with
+// bytes.IndexByte, so memory stays flat however long a line is and only
+// the start of each line is looked at to classify it.
+func countLines(r io.Reader, commentPrefixes []string, logical *logicalRule, indent bool) (LanguageStats, string, error) {
+	counter := newLineCounter(commentPrefixes)
+	counter.logical = logical
+	counter.indent = indent
+	buf := make([]byte, countChunkSize)
+	for {
+		n, err := r.Read(buf)
+		counter.write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			counter.finish()
+			return counter.stats, counter.lineEnding(), err
+		}
+	}
+	counter.finish()
+	return counter.stats, counter.lineEnding(), nil
+}
+
+// Line endings a file can have, as named in FileStats.LineEnding
+const (
+	endingLF    = "LF"
+	endingCRLF  = "CRLF"
+	endingMixed = "mixed"
+)
+
+// countLinesFast counts lines the same way as countLines without
+// classifying them, for languages left out of Options.Deep
+func countLinesFast(r io.Reader) (int, error) {
+	buf := make([]byte, countChunkSize)
+	lines := 0
+	unterminated := false
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			lines += bytes.Count(buf[:n], []byte{'\n'})
+			unterminated = buf[n-1] != '\n'
+		}
+		if err != nil {
+			if unterminated {
+				lines++
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			return lines, err
+		}
+	}
+}
+
+// lineCounter classifies lines from a stream of chunks that may split a
+// line anywhere
+type lineCounter struct {
+	stats    LanguageStats
+	prefixes [][]byte
+	// maxPrefix is the longest comment prefix; that many bytes from the
+	// first non-blank one decide whether a line is a comment
+	maxPrefix int
+
+	inLine  bool // bytes seen since the last newline
+	decided bool // kind of the current line is known
+	kind    lineKind
+	head    []byte // start of the current line, leading whitespace dropped
+
+	logical *logicalRule
+	// terminators on the current line, and whether it holds anything
+	// besides closing brackets
+	terminators int
+	substance   bool
+
+	// lastCR is set while the current line ends in "\r" so far
+	lastCR   bool
+	lf, crlf int
+
+	// indent tallies lines by their first byte, a tab or a space
+	indent bool
+	first  byte
+}
+
+func newLineCounter(commentPrefixes []string) *lineCounter {
+	c := &lineCounter{}
+	for _, prefix := range commentPrefixes {
+		c.prefixes = append(c.prefixes, []byte(prefix))
+		if len(prefix) > c.maxPrefix {
+			c.maxPrefix = len(prefix)
+		}
+	}
+	c.head = make([]byte, 0, c.maxPrefix)
+	return c
+}
+
+func (c *lineCounter) write(chunk []byte) {
+	for len(chunk) > 0 {
+		end := bytes.IndexByte(chunk, '\n')
+		segment := chunk
+		if end >= 0 {
+			segment = chunk[:end]
+		}
+
+		if len(segment) > 0 {
+			c.lastCR = segment[len(segment)-1] == '\r'
+			if !c.inLine {
+				c.first = segment[0]
+			}
+			c.inLine = true
+			if !c.decided {
+				c.scanHead(segment)
+			}
+			if c.logical != nil {
+				c.scanTerminators(segment)
+			}
+		}
+
+		if end < 0 {
+			return
+		}
+		if c.lastCR {
+			c.crlf++
+		} else {
+			c.lf++
+		}
+		c.inLine = true
+		c.endLine()
+		chunk = chunk[end+1:]
+	}
+}
+
+// scanHead collects the first non-blank bytes of the line until there
+// are enough to compare against every comment prefix
+func (c *lineCounter) scanHead(segment []byte) {
+	if len(c.head) == 0 {
+		segment = bytes.TrimLeft(segment, " \t\r\v\f")
+		if len(segment) == 0 {
+			return
+		}
+	}
+
+	// Anything non-blank is code unless a prefix says otherwise
+	if c.maxPrefix == 0 {
+		c.kind, c.decided = lineCode, true
+		return
+	}
+
+	need := c.maxPrefix - len(c.head)
+	if need > len(segment) {
+		need = len(segment)
+	}
+	c.head = append(c.head, segment[:need]...)
+	if len(c.head) == c.maxPrefix {
+		c.kind, c.decided = c.classifyHead(), true
+	}
+}
+
+func (c *lineCounter) classifyHead() lineKind {
+	if len(c.head) == 0 {
+		return lineBlank
+	}
+	for _, prefix := range c.prefixes {
+		if bytes.HasPrefix(c.head, prefix) {
+			return lineComment
+		}
+	}
+	return lineCode
+}
+
+func (c *lineCounter) endLine() {
+	if !c.decided {
+		c.kind = c.classifyHead()
+	}
+
+	c.stats.LineCount++
+	if c.indent && c.kind != lineBlank {
+		switch c.first {
+		case '\t':
+			c.stats.TabIndented++
+		case ' ':
+			c.stats.SpaceIndented++
+		}
+	}
+	switch c.kind {
+	case lineBlank:
+		c.stats.BlankLines++
+	case lineComment:
+		c.stats.CommentLines++
+	default:
+		c.stats.CodeLines++
+		if c.logical != nil {
+			c.stats.LogicalLines += c.terminators
+			if c.terminators == 0 && c.substance && c.logical.newlineEnds {
+				c.stats.LogicalLines++
+			}
+		}
+	}
+
+	c.inLine, c.decided = false, false
+	c.head = c.head[:0]
+	c.terminators, c.substance = 0, false
+	c.lastCR = false
+	c.first = 0
+}
+
+// logicalRule describes how statements end in a brace language
+type logicalRule struct {
+	// newlineEnds is set when a line break ends a statement without a
+	// semicolon, as in Go or Kotlin
+	newlineEnds bool
+}
+
+// Brace languages for which -logical counts statements. Every ";" and
+// "{" on a code line ends one; where newlines also end statements, a
+// code line with neither counts once unless it only closes brackets.
+// Semicolons inside strings or for-loop headers are counted as well, so
+// this is an estimate.
+var logicalRules = map[string]logicalRule{
+	"C":          {},
+	"C++":        {},
+	"Java":       {},
+	"JavaScript": {newlineEnds: true},
+	"TypeScript": {newlineEnds: true},
+	"JSX":        {newlineEnds: true},
+	"TSX":        {newlineEnds: true},
+	"PHP":        {},
+	"Rust":       {},
+	"Go":         {newlineEnds: true},
+	"Swift":      {newlineEnds: true},
+	"Kotlin":     {newlineEnds: true},
+}
+
+func (c *lineCounter) scanTerminators(segment []byte) {
+	c.terminators += bytes.Count(segment, []byte{';'}) + bytes.Count(segment, []byte{'{'})
+	if !c.substance && len(bytes.Trim(segment, " \t\r\v\f})],;")) > 0 {
+		c.substance = true
+	}
+}
+
+// lineEnding names the newlines seen, "" for a file without any
+func (c *lineCounter) lineEnding() string {
+	switch {
+	case c.lf > 0 && c.crlf > 0:
+		return endingMixed
+	case c.crlf > 0:
+		return endingCRLF
+	case c.lf > 0:
+		return endingLF
+	}
+	return ""
+}
+
+// finish counts a final line that has no trailing newline
+func (c *lineCounter) finish() {
+	if c.inLine {
+		c.endLine()
+	}
+}
+
+// headReader passes r through up to and including its lines'th newline,
+// then reports EOF without reading further
+type headReader struct {
+	r     io.Reader
+	lines int
+}
+
+func (h *headReader) Read(p []byte) (int, error) {
+	if h.lines <= 0 {
+		return 0, io.EOF
+	}
+	n, err := h.r.Read(p)
+	for i := 0; ; {
+		j := bytes.IndexByte(p[i:n], '\n')
+		if j < 0 {
+			break
+		}
+		i += j + 1
+		if h.lines--; h.lines == 0 {
+			return i, io.EOF
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCountLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		lines   int
+		code    int
+		comment int
+		blank   int
+		ending  string
+	}{
+		{"trailing newline", "a\n// b\n\n", 3, 1, 1, 1, endingLF},
+		{"no trailing newline", "a\n// b\n\nc", 4, 2, 1, 1, endingLF},
+		{"empty", "", 0, 0, 0, 0, ""},
+		{"single newline", "\n", 1, 0, 0, 1, endingLF},
+		{"crlf", "a\r\n// b\r\n\r\n", 3, 1, 1, 1, endingCRLF},
+		{"crlf without trailing newline", "a\r\nb", 2, 2, 0, 0, endingCRLF},
+		{"mixed", "a\r\nb\n", 2, 2, 0, 0, endingMixed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, ending, err := countLines(strings.NewReader(tt.input), []string{"//"}, nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.LineCount != tt.lines || stats.CodeLines != tt.code || stats.CommentLines != tt.comment || stats.BlankLines != tt.blank {
+				t.Errorf("got %d lines (%d code, %d comment, %d blank), want %d (%d, %d, %d)",
+					stats.LineCount, stats.CodeLines, stats.CommentLines, stats.BlankLines,
+					tt.lines, tt.code, tt.comment, tt.blank)
+			}
+			if ending != tt.ending {
+				t.Errorf("got line ending %q, want %q", ending, tt.ending)
+			}
+		})
+	}
+}
+
+// benchmarkSource is a Go-like file of about 1MB, with some long lines
+var benchmarkSource = func() string {
+	var b strings.Builder
+	for b.Len() < 1<<20 {
+		b.WriteString("// Package comment describing what follows\n")
+		b.WriteString("func example(a, b int) int {\n\treturn a + b\n}\n\n")
+		b.WriteString("var table = []string{" + strings.Repeat(`"entry", `, 40) + "}\n")
+	}
+	return b.String()
+}()
+
+func BenchmarkCountLines(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkSource)))
+	for i := 0; i < b.N; i++ {
+		if _, _, err := countLines(strings.NewReader(benchmarkSource), []string{"//"}, nil, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkScannerLines is the bufio.Scanner counter countLines replaced,
+// kept as the baseline to compare against
+func BenchmarkScannerLines(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkSource)))
+	for i := 0; i < b.N; i++ {
+		if _, err := scannerLines(strings.NewReader(benchmarkSource), []string{"//"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func scannerLines(r io.Reader, commentPrefixes []string) (LanguageStats, error) {
+	var stats LanguageStats
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 64<<20)
+	for lines.Scan() {
+		stats.LineCount++
+		trimmed := strings.TrimSpace(lines.Text())
+		switch {
+		case trimmed == "":
+			stats.BlankLines++
+		case scannerComment(trimmed, commentPrefixes):
+			stats.CommentLines++
+		default:
+			stats.CodeLines++
+		}
+	}
+	return stats, lines.Err()
+}
+
+func scannerComment(line string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// A generated file skipped before counting mustn't be cached with no
+// lines for a later run that keeps generated files
+func TestSkipGeneratedNotCached(t *testing.T) {
+	dir := t.TempDir()
+	source := "// Code generated by stringer. DO NOT EDIT.\n\npackage x\n\nconst a = 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "gen.go"), []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := LoadCache(filepath.Join(t.TempDir(), "cache.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions()
+	opts.Cache = cache
+	opts.SkipGenerated = true
+	report, err := Scan([]string{dir}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SkippedGenerated != 1 || report.Totals.FileCount != 0 {
+		t.Fatalf("skipped %d and counted %d files, want 1 and 0", report.SkippedGenerated, report.Totals.FileCount)
+	}
+
+	opts.SkipGenerated = false
+	report, err = Scan([]string{dir}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Totals.LineCount != 5 {
+		t.Errorf("counted %d lines of the generated file, want 5", report.Totals.LineCount)
+	}
+}
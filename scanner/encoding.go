@@ -0,0 +1,92 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// decodeBOM looks for a byte order mark at the start of r. UTF-16 text is
+// decoded to UTF-8 so the line counter sees real newlines instead of
+// "\n\x00"; its encoding name is returned, "" for anything else. The mark
+// itself is dropped so it can't hide a comment prefix on the first line.
+func decodeBOM(r io.Reader) (io.Reader, string) {
+	br := bufio.NewReaderSize(r, countChunkSize)
+	head, _ := br.Peek(3)
+	switch {
+	case bytes.HasPrefix(head, bomUTF8):
+		br.Discard(len(bomUTF8))
+		return br, ""
+	case bytes.HasPrefix(head, bomUTF16LE):
+		br.Discard(len(bomUTF16LE))
+		return &utf16Reader{src: br, order: binary.LittleEndian}, "UTF-16LE"
+	case bytes.HasPrefix(head, bomUTF16BE):
+		br.Discard(len(bomUTF16BE))
+		return &utf16Reader{src: br, order: binary.BigEndian}, "UTF-16BE"
+	}
+	return br, ""
+}
+
+// utf16Reader converts a UTF-16 stream to UTF-8 a chunk at a time
+type utf16Reader struct {
+	src   io.Reader
+	order binary.ByteOrder
+	// raw holds bytes read but not yet decoded: an odd trailing byte or
+	// a high surrogate waiting for its pair
+	raw []byte
+	// out is decoded UTF-8 not yet returned
+	out []byte
+	err error
+}
+
+func (r *utf16Reader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		chunk := make([]byte, len(r.raw)+countChunkSize)
+		copy(chunk, r.raw)
+		n, err := r.src.Read(chunk[len(r.raw):])
+		data := chunk[:len(r.raw)+n]
+		r.err = err
+
+		r.out = r.out[:0]
+		i := 0
+		for i+2 <= len(data) {
+			unit := rune(r.order.Uint16(data[i:]))
+			if unit >= 0xD800 && unit < 0xDC00 {
+				if i+4 > len(data) && r.err == nil {
+					break
+				}
+				if i+4 <= len(data) {
+					low := rune(r.order.Uint16(data[i+2:]))
+					if low >= 0xDC00 && low < 0xE000 {
+						r.out = utf8.AppendRune(r.out, utf16.DecodeRune(unit, low))
+						i += 4
+						continue
+					}
+				}
+				unit = utf8.RuneError
+			}
+			// A lone low surrogate isn't valid UTF-8 either; AppendRune
+			// writes U+FFFD for it
+			r.out = utf8.AppendRune(r.out, unit)
+			i += 2
+		}
+		r.raw = append(r.raw[:0], data[i:]...)
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
@@ -0,0 +1,47 @@
+package scanner
+
+import "bytes"
+
+// generatedPeek is how much of the start of a file is searched for a
+// generated-code marker; licence headers can push it down a few lines
+const generatedPeek = 2048
+
+// Markers that code generators put in a header comment: Go's and
+// protoc's warning against editing, Phabricator's tag and the .NET tool
+// header. They only count on comment lines, so code that merely
+// mentions them, like this file, isn't caught.
+var generatedMarkers = [][]byte{
+	[]byte("DO NOT EDIT"),
+	[]byte("@generated"),
+	[]byte("<auto-generated"),
+}
+
+var commentStarts = [][]byte{
+	[]byte("//"), []byte("#"), []byte("/*"), []byte("*"), []byte("--"), []byte("<!--"), []byte(";"),
+}
+
+// isGenerated reports whether head, the start of a file, has a comment
+// line carrying a generated-code marker
+func isGenerated(head []byte) bool {
+	for _, line := range bytes.Split(head, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if !hasAnyPrefix(line, commentStarts) {
+			continue
+		}
+		for _, marker := range generatedMarkers {
+			if bytes.Contains(line, marker) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(line []byte, prefixes [][]byte) bool {
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
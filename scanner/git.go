@@ -0,0 +1,44 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// trackedSet is the set of files git tracks below one scan root, plus
+// every directory leading to them so the walk can prune the rest
+type trackedSet struct {
+	files map[string]bool
+	dirs  map[string]bool
+}
+
+// gitTrackedFiles asks git for the files it tracks below root
+func gitTrackedFiles(root string) (*trackedSet, error) {
+	cmd := exec.Command("git", "-C", root, "ls-files", "-z")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	set := &trackedSet{files: make(map[string]bool), dirs: make(map[string]bool)}
+	cleanRoot := filepath.Clean(root)
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(cleanRoot, filepath.FromSlash(name))
+		set.files[path] = true
+		for dir := filepath.Dir(path); dir != cleanRoot && !set.dirs[dir]; dir = filepath.Dir(dir) {
+			set.dirs[dir] = true
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type ignoreRule struct {
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// gitIgnore holds the rules of a single .gitignore file. Patterns are
+// matched against slash separated paths relative to the file's directory.
+type gitIgnore struct {
+	rules []ignoreRule
+}
+
+func loadGitIgnore(filename string) (*gitIgnore, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ignore := &gitIgnore{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		// Without an inner slash the pattern matches at any depth
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		ignore.rules = append(ignore.rules, rule)
+	}
+	return ignore, scanner.Err()
+}
+
+// match reports whether rel is ignored. decided is false when no rule
+// mentions the path, so a parent directory's .gitignore gets a say.
+func (g *gitIgnore) match(rel string, isDir bool) (ignored, decided bool) {
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if matchPathPattern(rule.pattern, rel) {
+			ignored = !rule.negate
+			decided = true
+		}
+	}
+	return ignored, decided
+}
+
+// gitIgnoreSet tracks the .gitignore files seen while walking one root.
+// It is shared by the walker goroutines, hence the lock.
+type gitIgnoreSet struct {
+	root    string
+	mu      sync.RWMutex
+	ignores map[string]*gitIgnore
+}
+
+func newGitIgnoreSet(root string) *gitIgnoreSet {
+	return &gitIgnoreSet{root: filepath.Clean(root), ignores: make(map[string]*gitIgnore)}
+}
+
+// load picks up dir/.gitignore if present
+func (s *gitIgnoreSet) load(dir string) {
+	ignore, err := loadGitIgnore(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.ignores[filepath.Clean(dir)] = ignore
+	s.mu.Unlock()
+}
+
+// ignored checks p against the .gitignore files of its ancestors,
+// nearest first, stopping at the scan root.
+func (s *gitIgnoreSet) ignored(p string, isDir bool) bool {
+	p = filepath.Clean(p)
+	if p == s.root {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for dir := filepath.Dir(p); ; dir = filepath.Dir(dir) {
+		if ignore, ok := s.ignores[dir]; ok {
+			rel, err := filepath.Rel(dir, p)
+			if err == nil {
+				if ignored, decided := ignore.match(filepath.ToSlash(rel), isDir); decided {
+					return ignored
+				}
+			}
+		}
+		if dir == s.root || dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package scanner
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LanguageStats are the counts for one language, or for a single file
+type LanguageStats struct {
+	FileCount    int `json:"files"`
+	LineCount    int `json:"lines"`
+	CodeLines    int `json:"code"`
+	CommentLines int `json:"comments"`
+	BlankLines   int `json:"blanks"`
+	// LogicalLines is only counted with Options.Logical
+	LogicalLines int `json:"logical,omitempty"`
+	// Non-blank lines indented with a tab or a space, only counted
+	// with Options.Indent
+	TabIndented   int   `json:"tab_indented,omitempty"`
+	SpaceIndented int   `json:"space_indented,omitempty"`
+	ByteCount     int64 `json:"bytes"`
+	MaxBytes      int64 `json:"max_bytes"`
+}
+
+// Add accumulates other into s
+func (s *LanguageStats) Add(other LanguageStats) {
+	s.FileCount += other.FileCount
+	s.LineCount += other.LineCount
+	s.CodeLines += other.CodeLines
+	s.CommentLines += other.CommentLines
+	s.BlankLines += other.BlankLines
+	s.LogicalLines += other.LogicalLines
+	s.TabIndented += other.TabIndented
+	s.SpaceIndented += other.SpaceIndented
+	s.ByteCount += other.ByteCount
+	if other.MaxBytes > s.MaxBytes {
+		s.MaxBytes = other.MaxBytes
+	}
+}
+
+// scaled multiplies the counts by factor for a sampled estimate. The
+// largest file is a single file's size, so it stays as it is.
+func (s LanguageStats) scaled(factor float64) LanguageStats {
+	scale := func(n int) int { return int(math.Round(float64(n) * factor)) }
+	return LanguageStats{
+		FileCount:     scale(s.FileCount),
+		LineCount:     scale(s.LineCount),
+		CodeLines:     scale(s.CodeLines),
+		CommentLines:  scale(s.CommentLines),
+		BlankLines:    scale(s.BlankLines),
+		LogicalLines:  scale(s.LogicalLines),
+		TabIndented:   scale(s.TabIndented),
+		SpaceIndented: scale(s.SpaceIndented),
+		ByteCount:     int64(math.Round(float64(s.ByteCount) * factor)),
+		MaxBytes:      s.MaxBytes,
+	}
+}
+
+// AvgBytes is the mean file size, 0 when no files were counted
+func (s LanguageStats) AvgBytes() float64 {
+	if s.FileCount == 0 {
+		return 0
+	}
+	return float64(s.ByteCount) / float64(s.FileCount)
+}
+
+// AvgLines is the mean number of lines per file, 0 when no files were
+// counted
+func (s LanguageStats) AvgLines() float64 {
+	if s.FileCount == 0 {
+		return 0
+	}
+	return float64(s.LineCount) / float64(s.FileCount)
+}
+
+// CommentDensity is the percentage of lines that are comments, 0 when
+// there are no lines
+func (s LanguageStats) CommentDensity() float64 {
+	if s.LineCount == 0 {
+		return 0
+	}
+	return float64(s.CommentLines) * 100 / float64(s.LineCount)
+}
+
+// FileStats is the per-file result kept when Options.KeepFiles is set
+type FileStats struct {
+	Path     string        `json:"path"`
+	Language string        `json:"language"`
+	Stats    LanguageStats `json:"stats"`
+	// Encoding is set for files that weren't UTF-8, e.g. "UTF-16LE"
+	Encoding string `json:"encoding,omitempty"`
+	// LineEnding is "LF", "CRLF" or "mixed", empty without any newline
+	LineEnding string `json:"line_ending,omitempty"`
+	// Generated is set when the file's header marks it as generated
+	Generated bool `json:"generated,omitempty"`
+}
+
+// LineEndings counts files by the line endings they use
+type LineEndings struct {
+	LF    int `json:"lf"`
+	CRLF  int `json:"crlf"`
+	Mixed int `json:"mixed"`
+}
+
+func (e *LineEndings) add(ending string) {
+	switch ending {
+	case endingLF:
+		e.LF++
+	case endingCRLF:
+		e.CRLF++
+	case endingMixed:
+		e.Mixed++
+	}
+}
+
+// LanguageData pairs a language name with its stats
+type LanguageData struct {
+	Name  string        `json:"language"`
+	Stats LanguageStats `json:"stats"`
+}
+
+var languageExtMap = map[string]string{
+	".go":    "Go",
+	".py":    "Python",
+	".js":    "JavaScript",
+	".ts":    "TypeScript",
+	".java":  "Java",
+	".cpp":   "C++",
+	".c":     "C",
+	".rb":    "Ruby",
+	".php":   "PHP",
+	".rs":    "Rust",
+	".swift": "Swift",
+	".kt":    "Kotlin",
+	".jsx":   "JSX",
+	".tsx":   "TSX",
+	".html":  "HTML",
+	".htm":   "HTML",
+	".css":   "CSS",
+	".scss":  "SCSS",
+	".sass":  "Sass",
+	".less":  "Less",
+	".sql":   "SQL",
+	".sh":    "Shell",
+	".bash":  "Shell",
+	// Single-file components mix markup, script and style; they get
+	// one bucket each rather than being split by section
+	".vue":    "Vue",
+	".svelte": "Svelte",
+	// Counted by their code cells, see countNotebook
+	".ipynb": notebookLanguage,
+	// Config formats; not code as such, but part of the repo's size
+	".yaml": "YAML",
+	".yml":  "YAML",
+	".toml": "TOML",
+	".ini":  "INI",
+	".cfg":  "INI",
+	// Documentation, only counted with Options.Docs
+	".md":       "Markdown",
+	".markdown": "Markdown",
+	".rst":      "reStructuredText",
+	// Server-side and client-side templates share one bucket
+	".tmpl":     templateLanguage,
+	".ejs":      templateLanguage,
+	".hbs":      templateLanguage,
+	".mustache": templateLanguage,
+	".twig":     templateLanguage,
+}
+
+// docLanguages are prose rather than code; they stay out of the totals
+// unless asked for
+var docLanguages = map[string]bool{
+	"Markdown":         true,
+	"reStructuredText": true,
+}
+
+// Exact base names of build files that have no telling extension,
+// checked when the extension lookup fails
+var filenameLangMap = map[string]string{
+	"Dockerfile":     "Docker",
+	"Makefile":       "Make",
+	"makefile":       "Make",
+	"GNUmakefile":    "Make",
+	"CMakeLists.txt": "CMake",
+}
+
+// Extensions that only mean something when case is kept, consulted
+// before languageExtMap with Options.CaseSensitive
+var caseSensitiveExtMap = map[string]string{
+	".C":   "C++",
+	".H":   "C++",
+	".CPP": "C++",
+}
+
+// Multi-dot suffixes checked before the plain extension, since
+// filepath.Ext only sees the last dot
+var compoundExtMap = map[string]string{
+	".d.ts": dtsLanguage,
+}
+
+// dtsLanguage buckets TypeScript declaration files apart from source
+const dtsLanguage = "TypeScript Declarations"
+
+// templateLanguage covers Go, EJS, Handlebars, Mustache and Twig templates
+const templateLanguage = "Template"
+
+// Interpreters recognised in a "#!" line of extensionless scripts
+var shebangLangMap = map[string]string{
+	"python": "Python",
+	"node":   "JavaScript",
+	"ruby":   "Ruby",
+	"php":    "PHP",
+	"perl":   "Perl",
+	"bash":   "Shell",
+	"sh":     "Shell",
+	"zsh":    "Shell",
+	"ksh":    "Shell",
+	"dash":   "Shell",
+}
+
+// Single-line comment prefixes per language. Languages missing here
+// have all their non-blank lines counted as code.
+var commentPrefixMap = map[string][]string{
+	"Go":         {"//"},
+	"Python":     {"#"},
+	"JavaScript": {"//"},
+	"TypeScript": {"//"},
+	"Java":       {"//"},
+	"C++":        {"//"},
+	"C":          {"//"},
+	"Ruby":       {"#"},
+	"PHP":        {"//", "#"},
+	"Rust":       {"//"},
+	"Swift":      {"//"},
+	"Kotlin":     {"//"},
+	"Perl":       {"#"},
+	"Shell":      {"#"},
+	"JSX":        {"//"},
+	"TSX":        {"//"},
+	dtsLanguage:  {"//"},
+	"HTML":       {"<!--"},
+	"CSS":        {"/*"},
+	"SCSS":       {"//", "/*"},
+	"Sass":       {"//", "/*"},
+	"Less":       {"//", "/*"},
+	"Vue":        {"//", "<!--"},
+	"Svelte":     {"//", "<!--"},
+	"Docker":     {"#"},
+	"Make":       {"#"},
+	"CMake":      {"#"},
+	"SQL":        {"--"},
+	"YAML":       {"#"},
+	"TOML":       {"#"},
+	"INI":        {";", "#"},
+	"Markdown":   {"<!--"},
+	// Go, Handlebars/Mustache, Twig and EJS comments, then markup
+	templateLanguage: {"{{/*", "{{!", "{#", "<%#", "<!--"},
+	// Common notebook kernels without a source extension of their own
+	"R":     {"#"},
+	"Julia": {"#"},
+}
+
+// isGzipPath reports whether path names a gzip-compressed file
+func isGzipPath(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".gz")
+}
+
+// compoundExtLanguage looks name up in compoundExtMap; the longest
+// matching suffix wins
+func compoundExtLanguage(name string, caseSensitive bool) (string, bool) {
+	if !caseSensitive {
+		name = strings.ToLower(name)
+	}
+	var match, lang string
+	for suffix, candidate := range compoundExtMap {
+		if len(suffix) > len(match) && strings.HasSuffix(name, suffix) {
+			match, lang = suffix, candidate
+		}
+	}
+	return lang, match != ""
+}
+
+// detectShebang returns the language named by a file's "#!" line, or ""
+// when the file has none or the interpreter is unknown.
+func detectShebang(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	return shebangLanguage(file)
+}
+
+// shebangLanguage is detectShebang on the start of an open file
+func shebangLanguage(r io.Reader) string {
+	// Only the first line matters; don't read further into large binaries
+	buf := make([]byte, 256)
+	n, _ := io.ReadFull(r, buf)
+	line, _, _ := strings.Cut(string(buf[:n]), "\n")
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+
+	// "#!/usr/bin/env -S python3 -u" names the interpreter after env
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = filepath.Base(field)
+				break
+			}
+		}
+	}
+
+	// python3.11 -> python
+	interpreter = strings.TrimRight(interpreter, "0123456789.")
+	return shebangLangMap[interpreter]
+}
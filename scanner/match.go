@@ -0,0 +1,55 @@
+package scanner
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// matchesAny reports whether name matches one of the glob patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFilePattern matches an -exclude or -include pattern against a path
+// relative to the scan root. Patterns without a slash only look at the base name, so
+// "*.json" keeps matching at any depth; others match the whole relative
+// path and may use "**" to span directories.
+func matchFilePattern(pattern, relPath string) (bool, error) {
+	if !strings.Contains(pattern, "/") {
+		return filepath.Match(pattern, filepath.Base(relPath))
+	}
+	return matchPathPattern(pattern, filepath.ToSlash(relPath)), nil
+}
+
+// matchPathPattern matches a slash separated path against a glob where
+// "**" stands for any number of path segments, including none.
+func matchPathPattern(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// notebookLanguage is what the walk assigns to .ipynb files; counting
+// replaces it with the notebook's kernel language
+const notebookLanguage = "Jupyter Notebook"
+
+// notebook is the part of the .ipynb format needed to count code cells
+type notebook struct {
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+	Cells []struct {
+		CellType string         `json:"cell_type"`
+		Source   notebookSource `json:"source"`
+	} `json:"cells"`
+}
+
+// notebookSource is a cell's text, stored either as one string or as a
+// list of lines
+type notebookSource string
+
+func (s *notebookSource) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*s = notebookSource(strings.Join(lines, ""))
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*s = notebookSource(text)
+	return nil
+}
+
+// countNotebook counts the code cells of a notebook in its kernel's
+// language, Python when the notebook doesn't say. Markdown and raw cells
+// are ignored.
+func countNotebook(r io.Reader) (LanguageStats, string, error) {
+	var nb notebook
+	if err := json.NewDecoder(r).Decode(&nb); err != nil {
+		return LanguageStats{}, "", fmt.Errorf("invalid notebook: %w", err)
+	}
+
+	kernel := nb.Metadata.Kernelspec.Language
+	if kernel == "" {
+		kernel = nb.Metadata.LanguageInfo.Name
+	}
+	language := kernelLanguage(kernel)
+
+	var stats LanguageStats
+	for _, cell := range nb.Cells {
+		if cell.CellType != "code" {
+			continue
+		}
+		cellStats, _, err := countLines(strings.NewReader(string(cell.Source)), commentPrefixMap[language], nil, false)
+		if err != nil {
+			return LanguageStats{}, "", err
+		}
+		stats.Add(cellStats)
+	}
+	return stats, language, nil
+}
+
+// kernelLanguage maps a kernel's language name ("python", "R", "julia")
+// onto the names used elsewhere in the report
+func kernelLanguage(kernel string) string {
+	kernel = strings.TrimSpace(kernel)
+	if kernel == "" {
+		return "Python"
+	}
+	if lang, ok := shebangLangMap[strings.ToLower(kernel)]; ok {
+		return lang
+	}
+	for lang := range commentPrefixMap {
+		if strings.EqualFold(lang, kernel) {
+			return lang
+		}
+	}
+	return strings.ToUpper(kernel[:1]) + kernel[1:]
+}
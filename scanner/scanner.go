@@ -0,0 +1,785 @@
+// Package scanner walks source trees and counts lines of code, comments
+// and blanks per language. It is the engine behind the tokie command and
+// can be embedded in other Go tools:
+//
+//	report, err := scanner.Scan([]string{"."}, scanner.DefaultOptions())
+package scanner
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options control which files a scan visits and how they are counted.
+// The zero value walks every directory below the roots, as deep as they
+// go, with one worker per CPU; DefaultOptions also prunes version control
+// metadata.
+type Options struct {
+	// SkipDirs are glob patterns of directory names pruned from the walk
+	SkipDirs []string
+	// Exclude are file patterns relative to the scan root. Patterns
+	// without a slash match the base name; "**" spans directories.
+	Exclude []string
+	// Extensions, when set, restricts counting to files with exactly
+	// these extensions (".go"); unknown ones are reported under the
+	// extension itself
+	Extensions []string
+	// Include, when set, keeps only files matching at least one of these
+	// patterns, which work like Exclude's; Exclude still applies
+	Include []string
+	// SkipFiles are absolute paths left out wherever they are found, such
+	// as a report being written inside a root
+	SkipFiles []string
+	// MaxDepth limits how far below each root the walk descends; 0 means
+	// no limit and a negative value keeps to the files of the roots
+	MaxDepth         int
+	RespectGitignore bool
+	FollowSymlinks   bool
+	// StayInRoots skips symlinks below a root that lead out of it, so
+	// nothing outside the roots is read
+	StayInRoots bool
+	// GitTracked restricts the scan to files git tracks, falling back to
+	// a full walk outside a repository
+	GitTracked bool
+	// SkipHidden prunes dotfiles and dot-directories below the roots
+	SkipHidden bool
+	// SkipDTS leaves out TypeScript declaration files
+	SkipDTS bool
+	// SkipGenerated leaves out files marked as generated code, such as
+	// "// Code generated ... DO NOT EDIT."
+	SkipGenerated bool
+	// Docs counts documentation (Markdown, reStructuredText), which is
+	// left out by default so prose doesn't inflate code totals
+	Docs bool
+	// SkipShebang leaves extensionless files unopened
+	SkipShebang bool
+	// Languages maps extra extensions (with the leading dot, lower case
+	// unless CaseSensitive) to language names, overriding the built-in ones
+	Languages map[string]string
+	// Only, if set, restricts the scan to these languages (matched
+	// without regard to case); files of other languages aren't read
+	Only []string
+	// Deep, when set, limits the code/comment/blank split to these
+	// languages; files of the others only get their lines counted,
+	// which is faster
+	Deep []string
+	// Indent also counts lines indented with tabs and with spaces
+	Indent bool
+	// HeadLines, when positive, only counts the first that many lines of
+	// each file and stops reading there. Notebooks are still read whole.
+	HeadLines int
+	// Logical also counts logical lines (statements) for brace languages,
+	// a heuristic based on statement terminators
+	Logical bool
+	// CaseSensitive keeps the case of extensions, so ".C" is C++ and ".c"
+	// is C; by default extensions are lower-cased before lookup
+	CaseSensitive bool
+	// ModifiedSince, if set, skips files last modified before it
+	ModifiedSince time.Time
+	// MaxFileSize skips files larger than this many bytes; 0 is no limit
+	MaxFileSize int64
+	// Cache, if set, supplies counts for files unchanged since it was
+	// filled and records the rest; saving it is up to the caller
+	Cache *Cache
+
+	// Workers is the number of goroutines walking and counting; 0 means
+	// runtime.NumCPU()
+	Workers int
+	// Sample, between 0 and 1, counts only that random fraction of the
+	// matched files and scales the results up to an estimate; 0 counts
+	// every file
+	Sample float64
+	// IncludeOther also tallies the files no language was found for in
+	// Report.Other, by size only
+	IncludeOther bool
+	// ByDir fills in Report.Dirs
+	ByDir bool
+	// KeepFiles fills in Report.Files
+	KeepFiles bool
+	// RelativePaths reports files relative to the root they were
+	// found under, rather than as given
+	RelativePaths bool
+	// OnFile, if set, is called with each file as soon as it is counted.
+	// Calls are serialised, so it needn't lock.
+	OnFile func(FileStats)
+	// Progress, if set, is called periodically with the number of files
+	// counted so far
+	Progress func(processed int64)
+	// Warn receives non-fatal problems such as unreadable directories,
+	// for the caller to report
+	Warn func(FileError)
+}
+
+// ErrNotSource is the Warn error for a file root in no known language
+var ErrNotSource = errors.New("not a recognised source file")
+
+// DefaultOptions walks every directory below the roots except those of
+// git, Mercurial and Subversion, with one worker per CPU
+func DefaultOptions() Options {
+	return Options{
+		SkipDirs: []string{".git", ".hg", ".svn"},
+		Workers:  runtime.NumCPU(),
+	}
+}
+
+// FileError records a file that couldn't be counted, or only in part
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// Report is the result of a scan
+type Report struct {
+	// Languages has one entry per language found, sorted by name
+	Languages []LanguageData
+	Totals    LanguageStats
+	// Dirs totals each top-level directory below the roots, "." being
+	// the files directly in one. Only filled in with Options.ByDir,
+	// sorted by name.
+	Dirs []LanguageData
+	// Other has the files of no known language by extension, "(none)"
+	// for files without one, when Options.IncludeOther is set. Only the
+	// file and byte counts are filled in; they aren't part of Totals.
+	// Sorted by name.
+	Other []LanguageData
+	// Files is only filled in when Options.KeepFiles is set, sorted by path
+	Files []FileStats
+	// Errors lists files that failed to read, sorted by path
+	Errors []FileError
+	// DirErrors lists directories and zip archives that couldn't be read,
+	// such as ones without permission, sorted by path. The rest of the
+	// walk goes on.
+	DirErrors []FileError
+	// SkippedLarge counts files left out for exceeding Options.MaxFileSize
+	SkippedLarge int
+	// SkippedGenerated counts files left out by Options.SkipGenerated
+	SkippedGenerated int
+	// UTF16Files counts files decoded from UTF-16 before counting
+	UTF16Files int
+	// LineEndings tallies the files of each language by line ending
+	LineEndings map[string]LineEndings
+	// Estimated is set when Options.Sample scaled the stats up from
+	// SampledFiles of MatchedFiles; Files only lists the sampled ones
+	Estimated    bool
+	SampledFiles int
+	MatchedFiles int
+	// WalkTime is how long enumerating files took and ScanTime the whole
+	// scan; the walk overlaps counting, so WalkTime is part of ScanTime
+	WalkTime time.Duration
+	ScanTime time.Duration
+	// ReadTime is the time spent reading and counting files, summed over
+	// all workers
+	ReadTime time.Duration
+}
+
+// fileResult is a file found by the walk, waiting to be counted
+type fileResult struct {
+	path    string
+	relPath string
+	// dir is the top-level directory below the root, for Report.Dirs
+	dir      string
+	language string
+	// entry is set for files read from a zip archive, see visitZip
+	entry *zip.File
+}
+
+var errNoRoots = errors.New("no paths to scan")
+
+// errTooLarge marks a file skipped for exceeding Options.MaxFileSize
+var errTooLarge = errors.New("file too large")
+
+// Scan counts every matching file below roots, which may be directories
+// or single files
+func Scan(roots []string, opts Options) (Report, error) {
+	return ScanContext(context.Background(), roots, opts)
+}
+
+// ScanContext is Scan with cancellation. When ctx is cancelled it stops
+// early and returns what was counted so far along with ctx.Err().
+func ScanContext(ctx context.Context, roots []string, opts Options) (Report, error) {
+	if len(roots) == 0 {
+		return Report{}, errNoRoots
+	}
+	if err := opts.validate(roots); err != nil {
+		return Report{}, err
+	}
+	opts = opts.withDefaults()
+	return scan(ctx, opts, func(w *walker) {
+		w.run(ctx, roots, opts.Workers)
+	})
+}
+
+// ScanFiles counts exactly the given files, such as a list from git or
+// find, without walking any directory. Paths of unknown languages and
+// directories are skipped quietly; missing files are warned about.
+func ScanFiles(paths []string, opts Options) (Report, error) {
+	return ScanFilesContext(context.Background(), paths, opts)
+}
+
+// ScanFilesContext is ScanFiles with cancellation
+func ScanFilesContext(ctx context.Context, paths []string, opts Options) (Report, error) {
+	if err := opts.validate(nil); err != nil {
+		return Report{}, err
+	}
+	opts = opts.withDefaults()
+	return scan(ctx, opts, func(w *walker) {
+		w.ctx = ctx
+		for _, path := range paths {
+			if ctx.Err() != nil {
+				return
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				w.opts.Warn(FileError{Path: path, Err: fmt.Errorf("skipping: %w", err)})
+				continue
+			}
+			if !info.IsDir() {
+				w.visitFile("", path, path, info.Mode().IsRegular())
+			}
+		}
+	})
+}
+
+// tally is what one worker has counted, merged into the report once all
+// of them are done
+type tally struct {
+	languages        map[string]*LanguageStats
+	dirs             map[string]*LanguageStats
+	other            map[string]*LanguageStats
+	lineEndings      map[string]LineEndings
+	errors           []FileError
+	files            []FileStats
+	utf16Files       int
+	skippedGenerated int
+}
+
+func newTally() *tally {
+	return &tally{
+		languages:   make(map[string]*LanguageStats),
+		dirs:        make(map[string]*LanguageStats),
+		other:       make(map[string]*LanguageStats),
+		lineEndings: make(map[string]LineEndings),
+	}
+}
+
+// merge adds other's counts into t
+func (t *tally) merge(other *tally) {
+	for name, stat := range other.languages {
+		addStats(t.languages, name, *stat)
+	}
+	for dir, stat := range other.dirs {
+		addStats(t.dirs, dir, *stat)
+	}
+	for ext, stat := range other.other {
+		addStats(t.other, ext, *stat)
+	}
+	for lang, endings := range other.lineEndings {
+		merged := t.lineEndings[lang]
+		merged.LF += endings.LF
+		merged.CRLF += endings.CRLF
+		merged.Mixed += endings.Mixed
+		t.lineEndings[lang] = merged
+	}
+	t.errors = append(t.errors, other.errors...)
+	t.files = append(t.files, other.files...)
+	t.utf16Files += other.utf16Files
+	t.skippedGenerated += other.skippedGenerated
+}
+
+// addStats accumulates stat into m[key], creating the entry if needed
+func addStats(m map[string]*LanguageStats, key string, stat LanguageStats) {
+	if _, exists := m[key]; !exists {
+		m[key] = &LanguageStats{}
+	}
+	m[key].Add(stat)
+}
+
+// scan runs the counting workers over whatever files feed sends to the
+// walker
+func scan(ctx context.Context, opts Options, feed func(w *walker)) (Report, error) {
+	scanStart := time.Now()
+	report := Report{}
+	// Each worker tallies on its own; only OnFile calls are serialised
+	tallies := make([]*tally, opts.Workers)
+	var onFileMutex sync.Mutex
+	var processed, skippedLarge, readNanos atomic.Int64
+	var matched, sampled atomic.Int64
+	sampling := opts.Sample > 0 && opts.Sample < 1
+
+	// channels for the pipeline
+	filesChan := make(chan fileResult, 1000)
+	done := make(chan bool)
+
+	var wg sync.WaitGroup
+	for i := range tallies {
+		tallies[i] = newTally()
+		wg.Add(1)
+		go func(t *tally) {
+			defer wg.Done()
+			for result := range filesChan {
+				// Drain without reading once the scan is cancelled
+				if ctx.Err() != nil {
+					continue
+				}
+				matched.Add(1)
+				if sampling && rand.Float64() >= opts.Sample {
+					processed.Add(1)
+					continue
+				}
+				sampled.Add(1)
+				if result.language == otherLanguage {
+					processed.Add(1)
+					size, err := otherFileSize(result, opts)
+					switch {
+					case errors.Is(err, errTooLarge):
+						skippedLarge.Add(1)
+					case err != nil:
+						t.errors = append(t.errors, FileError{Path: result.path, Err: err})
+					default:
+						addStats(t.other, otherExt(result.relPath), LanguageStats{FileCount: 1, ByteCount: size, MaxBytes: size})
+					}
+					continue
+				}
+				readStart := time.Now()
+				counted, ok, err := processFile(result, opts)
+				readNanos.Add(int64(time.Since(readStart)))
+				processed.Add(1)
+				if errors.Is(err, errTooLarge) {
+					skippedLarge.Add(1)
+					continue
+				}
+
+				if err != nil {
+					t.errors = append(t.errors, FileError{Path: result.path, Err: err})
+				}
+				// A notebook's language is only known once it is read
+				if ok && !opts.allowsLanguage(counted.Language) {
+					ok = false
+				}
+				if ok && counted.Generated && opts.SkipGenerated {
+					t.skippedGenerated++
+					ok = false
+				}
+				if !ok {
+					continue
+				}
+				addStats(t.languages, counted.Language, counted.Stats)
+				if opts.ByDir {
+					addStats(t.dirs, result.dir, counted.Stats)
+				}
+				if counted.Encoding != "" {
+					t.utf16Files++
+				}
+				if counted.LineEnding != "" {
+					endings := t.lineEndings[counted.Language]
+					endings.add(counted.LineEnding)
+					t.lineEndings[counted.Language] = endings
+				}
+				if opts.RelativePaths {
+					counted.Path = result.relPath
+				}
+				if opts.KeepFiles {
+					t.files = append(t.files, counted)
+				}
+				if opts.OnFile != nil {
+					onFileMutex.Lock()
+					opts.OnFile(counted)
+					onFileMutex.Unlock()
+				}
+			}
+		}(tallies[i])
+	}
+
+	// The walker's archives stay open until the workers are done
+	var archives *walker
+	go func() {
+		w := newWalker(opts, filesChan)
+		feed(w)
+		report.WalkTime = time.Since(scanStart)
+		report.DirErrors = w.dirErrors
+		archives = w
+
+		close(filesChan)
+	}()
+
+	// Periodic progress callbacks while the workers drain filesChan
+	progressDone := make(chan bool)
+	go func() {
+		defer close(progressDone)
+		if opts.Progress == nil {
+			<-done
+			return
+		}
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				opts.Progress(processed.Load())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+	<-progressDone
+	archives.closeArchives()
+
+	total := newTally()
+	for _, t := range tallies {
+		total.merge(t)
+	}
+	stats, dirStats, otherStats := total.languages, total.dirs, total.other
+	report.Errors = total.errors
+	report.Files = total.files
+	report.LineEndings = total.lineEndings
+	report.UTF16Files = total.utf16Files
+	report.SkippedGenerated = total.skippedGenerated
+
+	// Every file stood the same chance, so the sample scales up evenly
+	if sampling {
+		report.Estimated = true
+		report.MatchedFiles = int(matched.Load())
+		report.SampledFiles = int(sampled.Load())
+		if report.SampledFiles > 0 {
+			factor := float64(report.MatchedFiles) / float64(report.SampledFiles)
+			for _, stat := range stats {
+				*stat = stat.scaled(factor)
+			}
+			for _, stat := range dirStats {
+				*stat = stat.scaled(factor)
+			}
+			for _, stat := range otherStats {
+				*stat = stat.scaled(factor)
+			}
+		}
+	}
+
+	report.Languages = make([]LanguageData, 0, len(stats))
+	for lang, stat := range stats {
+		report.Languages = append(report.Languages, LanguageData{Name: lang, Stats: *stat})
+		report.Totals.Add(*stat)
+	}
+	sort.Slice(report.Languages, func(i, j int) bool { return report.Languages[i].Name < report.Languages[j].Name })
+	for dir, stat := range dirStats {
+		report.Dirs = append(report.Dirs, LanguageData{Name: dir, Stats: *stat})
+	}
+	sort.Slice(report.Dirs, func(i, j int) bool { return report.Dirs[i].Name < report.Dirs[j].Name })
+	for ext, stat := range otherStats {
+		report.Other = append(report.Other, LanguageData{Name: ext, Stats: *stat})
+	}
+	sort.Slice(report.Other, func(i, j int) bool { return report.Other[i].Name < report.Other[j].Name })
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].Path < report.Files[j].Path })
+	sort.Slice(report.Errors, func(i, j int) bool { return report.Errors[i].Path < report.Errors[j].Path })
+	sort.Slice(report.DirErrors, func(i, j int) bool { return report.DirErrors[i].Path < report.DirErrors[j].Path })
+	report.SkippedLarge = int(skippedLarge.Load())
+	report.ReadTime = time.Duration(readNanos.Load())
+	report.ScanTime = time.Since(scanStart)
+
+	return report, ctx.Err()
+}
+
+// List returns the sorted paths a scan would count, without reading any
+// of them
+func List(roots []string, opts Options) ([]string, error) {
+	return ListContext(context.Background(), roots, opts)
+}
+
+// ListContext is List with cancellation
+func ListContext(ctx context.Context, roots []string, opts Options) ([]string, error) {
+	if len(roots) == 0 {
+		return nil, errNoRoots
+	}
+	if err := opts.validate(roots); err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+
+	listChan := make(chan fileResult, 1000)
+	go func() {
+		w := newWalker(opts, listChan)
+		w.run(ctx, roots, opts.Workers)
+		w.closeArchives()
+		for _, dirErr := range w.dirErrors {
+			opts.Warn(FileError{Path: dirErr.Path, Err: fmt.Errorf("can't walk directory: %w", dirErr.Err)})
+		}
+		close(listChan)
+	}()
+
+	var paths []string
+	for result := range listChan {
+		paths = append(paths, result.path)
+	}
+	sort.Strings(paths)
+	return paths, ctx.Err()
+}
+
+// validate rejects roots that can't be scanned and malformed patterns
+func (opts Options) validate(roots []string) error {
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			return fmt.Errorf("cannot access %s: %w", root, err)
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a directory or regular file", root)
+		}
+	}
+	for _, pattern := range opts.Exclude {
+		if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+	for _, pattern := range opts.Include {
+		if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil {
+			return fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+	}
+	if opts.Workers < 0 {
+		return fmt.Errorf("invalid worker count %d", opts.Workers)
+	}
+	if opts.Sample < 0 || opts.Sample > 1 {
+		return fmt.Errorf("invalid sample fraction %g", opts.Sample)
+	}
+	return nil
+}
+
+// countMode is how files of a language are counted, which cached
+// counts must match
+type countMode struct {
+	logical bool
+	indent  bool
+	shallow bool
+	head    int
+}
+
+func (opts Options) countMode(lang string) countMode {
+	mode := countMode{logical: opts.Logical, indent: opts.Indent}
+	if lang != notebookLanguage {
+		mode.head = opts.HeadLines
+	}
+	if len(opts.Deep) > 0 && lang != notebookLanguage && !ContainsFold(opts.Deep, lang) {
+		mode.shallow = true
+	}
+	return mode
+}
+
+// allowsLanguage reports whether files of lang pass Options.Only
+func (opts Options) allowsLanguage(lang string) bool {
+	if len(opts.Only) == 0 {
+		return true
+	}
+	return ContainsFold(opts.Only, lang)
+}
+
+// ContainsFold reports whether names holds name, ignoring case and
+// surrounding spaces
+func ContainsFold(names []string, name string) bool {
+	for _, candidate := range names {
+		if strings.EqualFold(strings.TrimSpace(candidate), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (opts Options) withDefaults() Options {
+	if opts.Workers == 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.Warn == nil {
+		opts.Warn = func(FileError) {}
+	}
+	return opts
+}
+
+// depthLimit is MaxDepth as the deepest level to walk, -1 for no limit
+func (opts Options) depthLimit() int {
+	switch {
+	case opts.MaxDepth == 0:
+		return -1
+	case opts.MaxDepth < 0:
+		return 0
+	}
+	return opts.MaxDepth
+}
+
+// Transient read errors, which network filesystems produce now and then,
+// are retried this many times in all, backing off from readBackoff
+const (
+	readAttempts = 3
+	readBackoff  = 50 * time.Millisecond
+)
+
+// processFile counts a single file. The language in the result may differ
+// from the one the walk guessed, for notebooks. ok is false when the file
+// wasn't counted; err is set when it couldn't be read, or only partly.
+func processFile(result fileResult, opts Options) (counted FileStats, ok bool, err error) {
+	for attempt := 1; ; attempt++ {
+		if result.entry != nil {
+			counted, ok, err = countEntry(result, opts)
+		} else {
+			counted, ok, err = countFile(result.path, result.language, opts)
+		}
+		if err == nil || !isTransient(err) {
+			return counted, ok, err
+		}
+		if attempt == readAttempts {
+			return counted, ok, fmt.Errorf("%w (gave up after %d attempts)", err, attempt)
+		}
+		time.Sleep(readBackoff << (attempt - 1))
+	}
+}
+
+// otherLanguage marks files of no known language for Options.IncludeOther
+const otherLanguage = ""
+
+// otherFileSize is the size of an IncludeOther file, which isn't read
+func otherFileSize(result fileResult, opts Options) (int64, error) {
+	var size int64
+	if result.entry != nil {
+		size = int64(result.entry.UncompressedSize64)
+	} else {
+		info, err := os.Stat(result.path)
+		if err != nil {
+			return 0, err
+		}
+		size = info.Size()
+	}
+	if opts.MaxFileSize > 0 && size > opts.MaxFileSize {
+		return 0, errTooLarge
+	}
+	return size, nil
+}
+
+// otherExt is the Report.Other key for relPath
+func otherExt(relPath string) string {
+	ext := strings.ToLower(filepath.Ext(filepath.Base(relPath)))
+	if ext == "" {
+		return "(none)"
+	}
+	return ext
+}
+
+// countFile is one attempt at processFile
+func countFile(path, language string, opts Options) (counted FileStats, ok bool, err error) {
+	counted = FileStats{Path: path, Language: language}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return counted, false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return counted, false, err
+	}
+	if opts.MaxFileSize > 0 && info.Size() > opts.MaxFileSize {
+		return counted, false, errTooLarge
+	}
+	if opts.Cache != nil {
+		if cached, hit := opts.Cache.lookup(path, language, opts.countMode(language), info); hit {
+			return cached, true, nil
+		}
+	}
+
+	counted, ok, err = countContent(counted, file, opts)
+	if !ok {
+		return counted, false, err
+	}
+	counted.Stats.FileCount = 1
+	counted.Stats.ByteCount = info.Size()
+	counted.Stats.MaxBytes = info.Size()
+	// Partial counts are retried next time rather than remembered, and so
+	// are the generated files skipped before being counted
+	if opts.Cache != nil && err == nil && !(counted.Generated && opts.SkipGenerated) {
+		opts.Cache.store(path, language, opts.countMode(language), info, counted)
+	}
+	return counted, true, err
+}
+
+// countContent counts what was read from a file or archive entry, filling
+// in everything but the counted's file and byte counts
+func countContent(counted FileStats, content io.Reader, opts Options) (FileStats, bool, error) {
+	language := counted.Language
+	var err error
+	// Compressed sources are counted by their decompressed content
+	if isGzipPath(counted.Path) {
+		gz, err := gzip.NewReader(content)
+		if err != nil {
+			return counted, false, err
+		}
+		defer gz.Close()
+		content = gz
+	}
+	content, counted.Encoding = decodeBOM(content)
+	if head := opts.countMode(language).head; head > 0 {
+		content = &headReader{r: content, lines: head}
+	}
+
+	// Looked up on every file so cached counts know it too
+	if language != notebookLanguage {
+		buffered := bufio.NewReaderSize(content, countChunkSize)
+		head, _ := buffered.Peek(generatedPeek)
+		counted.Generated = isGenerated(head)
+		content = buffered
+	}
+	// The caller drops it, so counting it would be wasted reading
+	if counted.Generated && opts.SkipGenerated {
+		return counted, true, nil
+	}
+
+	// Notebooks are JSON; only the code inside their cells is counted
+	if language == notebookLanguage {
+		fileStats, kernel, err := countNotebook(content)
+		if err != nil {
+			return counted, false, err
+		}
+		counted.Language = kernel
+		counted.Stats = fileStats
+	} else if opts.countMode(language).shallow {
+		counted.Stats.LineCount, err = countLinesFast(content)
+		if err != nil {
+			err = fmt.Errorf("line count may be incomplete: %w", err)
+		}
+	} else {
+		// A read error part way through still counts what was read
+		var logical *logicalRule
+		if opts.Logical {
+			if rule, ok := logicalRules[language]; ok {
+				logical = &rule
+			}
+		}
+		counted.Stats, counted.LineEnding, err = countLines(content, commentPrefixMap[language], logical, opts.Indent)
+		if err != nil {
+			err = fmt.Errorf("line count may be incomplete: %w", err)
+		}
+	}
+	return counted, true, err
+}
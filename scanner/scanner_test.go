@@ -0,0 +1,132 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// benchmarkTree writes dirs directories of small files in several
+// languages, so workers spend their time merging rather than reading
+func benchmarkTree(b *testing.B, dirs, filesPerDir int) string {
+	root := b.TempDir()
+	exts := []string{".go", ".py", ".js", ".c", ".rs"}
+	content := []byte(strings.Repeat("// comment\ncode()\n\n", 10))
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%03d", d))
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			b.Fatal(err)
+		}
+		for f := 0; f < filesPerDir; f++ {
+			name := filepath.Join(dir, fmt.Sprintf("file%03d%s", f, exts[f%len(exts)]))
+			if err := os.WriteFile(name, content, 0o644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+// benchmarkWorkers are the worker counts both scan benchmarks sweep
+var benchmarkWorkers = []int{1, 4, 16, 64}
+
+// BenchmarkScan counts a generated tree of 4000 files with a growing
+// number of workers, each tallying on its own; compare it with
+// BenchmarkScanSharedMutex under -cpu on a many-core machine
+func BenchmarkScan(b *testing.B) {
+	root := benchmarkTree(b, 40, 100)
+	for _, workers := range benchmarkWorkers {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			opts := benchmarkOptions(workers)
+			for i := 0; i < b.N; i++ {
+				report, err := Scan([]string{root}, opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if report.Totals.FileCount != 4000 {
+					b.Fatalf("counted %d files, want 4000", report.Totals.FileCount)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkScanSharedMutex is the same scan with the loop per-worker
+// tallies replaced, every worker adding into one tally under a shared
+// mutex, kept as the baseline to compare against
+func BenchmarkScanSharedMutex(b *testing.B) {
+	root := benchmarkTree(b, 40, 100)
+	for _, workers := range benchmarkWorkers {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			opts := benchmarkOptions(workers)
+			for i := 0; i < b.N; i++ {
+				total := sharedMutexScan([]string{root}, opts)
+				if files := total.languages["Go"].FileCount; files != 800 {
+					b.Fatalf("counted %d Go files, want 800", files)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkOptions keeps every per-file tally busy: directories, the
+// file list and an OnFile callback
+func benchmarkOptions(workers int) Options {
+	opts := DefaultOptions()
+	opts.Workers = workers
+	opts.ByDir = true
+	opts.KeepFiles = true
+	opts.OnFile = func(FileStats) {}
+	return opts
+}
+
+func sharedMutexScan(roots []string, opts Options) *tally {
+	opts = opts.withDefaults()
+	filesChan := make(chan fileResult, 1000)
+	total := newTally()
+	var mu sync.Mutex
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for result := range filesChan {
+				counted, ok, err := processFile(result, opts)
+				mu.Lock()
+				if err != nil {
+					total.errors = append(total.errors, FileError{Path: result.path, Err: err})
+				}
+				if ok {
+					addStats(total.languages, counted.Language, counted.Stats)
+					if opts.ByDir {
+						addStats(total.dirs, result.dir, counted.Stats)
+					}
+					if counted.LineEnding != "" {
+						endings := total.lineEndings[counted.Language]
+						endings.add(counted.LineEnding)
+						total.lineEndings[counted.Language] = endings
+					}
+					if opts.KeepFiles {
+						total.files = append(total.files, counted)
+					}
+					if opts.OnFile != nil {
+						opts.OnFile(counted)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	w := newWalker(opts, filesChan)
+	w.run(context.Background(), roots, opts.Workers)
+	close(filesChan)
+	wg.Wait()
+	w.closeArchives()
+	return total
+}
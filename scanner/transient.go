@@ -0,0 +1,14 @@
+//go:build !plan9
+
+package scanner
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isTransient reports whether err is the kind of I/O hiccup worth
+// another try, as opposed to a missing or forbidden file
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.ESTALE)
+}
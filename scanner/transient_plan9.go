@@ -0,0 +1,12 @@
+package scanner
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isTransient reports whether err is the kind of I/O hiccup worth
+// another try; Plan 9 has no EAGAIN or ESTALE
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.EINTR)
+}
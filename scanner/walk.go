@@ -0,0 +1,402 @@
+package scanner
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// dirTask is one directory waiting to be read
+type dirTask struct {
+	root    string
+	path    string
+	depth   int
+	ignores *gitIgnoreSet
+	// tracked restricts the walk to git-tracked files when set
+	tracked *trackedSet
+}
+
+// walker enumerates files below a set of roots with a pool of goroutines
+// sharing a queue of directories. A worker that finds the queue full reads
+// the subdirectory itself, so enumeration never blocks on the queue.
+type walker struct {
+	ctx   context.Context
+	opts  Options
+	files chan<- fileResult
+
+	queue   chan dirTask
+	pending sync.WaitGroup
+
+	mu sync.Mutex
+	// Overlapping roots can reach the same file twice
+	seen map[string]bool
+	// Real paths of directories entered, so symlink cycles terminate
+	visitedDirs map[string]bool
+	// Directories that couldn't be read; the walk carries on without them
+	dirErrors []FileError
+	// prefixRoots names top-level directories with their root, as set
+	// when walking several
+	prefixRoots bool
+	// archives are the zip roots opened by visitZip
+	archives []*zip.ReadCloser
+}
+
+func newWalker(opts Options, files chan<- fileResult) *walker {
+	w := &walker{
+		opts:        opts,
+		files:       files,
+		seen:        make(map[string]bool),
+		visitedDirs: make(map[string]bool),
+	}
+	// Skipped files count as seen, under the key a symlinked walk uses too
+	for _, path := range opts.SkipFiles {
+		w.seen[path] = true
+		if realPath, err := realAbs(path); err == nil {
+			w.seen[realPath] = true
+		}
+	}
+	return w
+}
+
+// run walks every root with numWorkers goroutines and returns once all
+// matching files have been sent or ctx is cancelled
+func (w *walker) run(ctx context.Context, roots []string, numWorkers int) {
+	w.ctx = ctx
+	w.queue = make(chan dirTask, numWorkers*64)
+	w.prefixRoots = len(roots) > 1
+
+	for _, root := range roots {
+		// A file given as a root is counted on its own, with no walk,
+		// unless it is an archive to scan the entries of
+		if info, err := os.Stat(root); err == nil && info.Mode().IsRegular() && isZipPath(root) {
+			w.visitZip(root)
+			continue
+		} else if err == nil && !info.IsDir() {
+			if !w.visitFile(root, root, filepath.Base(root), info.Mode().IsRegular()) {
+				w.opts.Warn(FileError{Path: root, Err: ErrNotSource})
+			}
+			continue
+		}
+
+		if w.opts.FollowSymlinks {
+			if realPath, err := realAbs(root); err == nil {
+				w.visitedDirs[realPath] = true
+			}
+		}
+		task := dirTask{root: root, path: root, ignores: newGitIgnoreSet(root)}
+		if w.opts.GitTracked {
+			tracked, err := gitTrackedFiles(root)
+			if err != nil {
+				w.opts.Warn(FileError{Path: root, Err: fmt.Errorf("can't list git-tracked files, scanning everything: %w", err)})
+			} else {
+				task.tracked = tracked
+			}
+		}
+		w.schedule(task)
+	}
+
+	var workers sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for task := range w.queue {
+				w.readDir(task)
+				w.pending.Done()
+			}
+		}()
+	}
+
+	w.pending.Wait()
+	close(w.queue)
+	workers.Wait()
+}
+
+func (w *walker) schedule(task dirTask) {
+	w.pending.Add(1)
+	select {
+	case w.queue <- task:
+	default:
+		w.readDir(task)
+		w.pending.Done()
+	}
+}
+
+func (w *walker) readDir(task dirTask) {
+	if w.ctx.Err() != nil {
+		return
+	}
+	if w.opts.RespectGitignore {
+		task.ignores.load(task.path)
+	}
+
+	// An error part way through still leaves the entries read before it
+	entries, err := os.ReadDir(task.path)
+	if err != nil {
+		w.mu.Lock()
+		w.dirErrors = append(w.dirErrors, FileError{Path: task.path, Err: err})
+		w.mu.Unlock()
+	}
+
+	for _, entry := range entries {
+		if w.opts.SkipHidden && strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(task.path, entry.Name())
+		isDir := entry.IsDir()
+		isRegular := entry.Type().IsRegular()
+
+		// Links out of the root aren't read at all with StayInRoots
+		if w.opts.StayInRoots && entry.Type()&os.ModeSymlink != 0 && !linksWithin(path, task.root) {
+			continue
+		}
+		// Symlinked directories are only entered when asked to
+		if w.opts.FollowSymlinks && entry.Type()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(path); err == nil {
+				isDir = target.IsDir()
+			}
+		}
+
+		if w.opts.RespectGitignore && task.ignores.ignored(path, isDir) {
+			continue
+		}
+
+		if isDir {
+			w.enterDir(task, path, entry.Name())
+			continue
+		}
+		if task.tracked != nil && !task.tracked.files[path] {
+			continue
+		}
+
+		relPath, err := filepath.Rel(task.root, path)
+		if err != nil {
+			relPath = path
+		}
+		w.visitFile(task.root, path, relPath, isRegular)
+	}
+}
+
+func (w *walker) enterDir(parent dirTask, path, name string) {
+	// Prune skipped directories, node_modules included when flagged
+	if matchesAny(w.opts.SkipDirs, name) {
+		return
+	}
+	if parent.tracked != nil && !parent.tracked.dirs[path] {
+		return
+	}
+
+	// A directory whose relative path has N segments holds files at
+	// depth N; depth 0 is the root itself
+	depth := parent.depth + 1
+	if limit := w.opts.depthLimit(); limit >= 0 && depth > limit {
+		return
+	}
+
+	if w.opts.FollowSymlinks {
+		realPath, err := realAbs(path)
+		if err != nil {
+			return
+		}
+		w.mu.Lock()
+		visited := w.visitedDirs[realPath]
+		w.visitedDirs[realPath] = true
+		w.mu.Unlock()
+		if visited {
+			return
+		}
+	}
+
+	w.schedule(dirTask{root: parent.root, path: path, depth: depth, ignores: parent.ignores, tracked: parent.tracked})
+}
+
+// visitFile sends path on for counting if it passes the filters and its
+// language is known, reporting whether it did
+func (w *walker) visitFile(root, path, relPath string, isRegular bool) bool {
+	var shebang func() string
+	if isRegular && !w.opts.SkipShebang {
+		shebang = func() string { return detectShebang(path) }
+	}
+	lang, ok := w.opts.fileLanguage(relPath, shebang)
+	if !ok {
+		return false
+	}
+
+	if !w.opts.ModifiedSince.IsZero() {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Before(w.opts.ModifiedSince) {
+			return false
+		}
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	if w.opts.FollowSymlinks {
+		if realPath, err := realAbs(path); err == nil {
+			absPath = realPath
+		}
+	}
+
+	w.mu.Lock()
+	seen := w.seen[absPath]
+	w.seen[absPath] = true
+	w.mu.Unlock()
+	if seen {
+		return false
+	}
+
+	select {
+	case w.files <- fileResult{path: path, relPath: relPath, dir: w.topDir(root, relPath), language: lang}:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// included reports whether relPath matches one of the include patterns
+func (opts Options) included(relPath string) bool {
+	for _, pattern := range opts.Include {
+		if matched, err := matchFilePattern(strings.TrimSpace(pattern), relPath); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsExt reports whether ext is one of Options.Extensions
+func (opts Options) allowsExt(ext string) bool {
+	for _, allowed := range opts.Extensions {
+		if allowed == ext || (!opts.CaseSensitive && strings.EqualFold(allowed, ext)) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileLanguage runs the filters that only need a file's name and finds
+// its language: exclude and include patterns, Extensions, the extension
+// and file name maps, then shebang when given (for files without an
+// extension), Only and Docs. Both the walk and GitChurn use it.
+// Unrecognised files come back as otherLanguage with IncludeOther.
+func (opts Options) fileLanguage(relPath string, shebang func() string) (string, bool) {
+	// Checking exclude patterns
+	for _, pattern := range opts.Exclude {
+		matched, err := matchFilePattern(strings.TrimSpace(pattern), relPath)
+		if err != nil || matched {
+			return "", false
+		}
+	}
+	if len(opts.Include) > 0 && !opts.included(relPath) {
+		return "", false
+	}
+
+	// "app.js.gz" is detected as "app.js"
+	name := filepath.Base(relPath)
+	compressed := isGzipPath(name)
+	if compressed {
+		name = name[:len(name)-len(".gz")]
+	}
+
+	ext := filepath.Ext(name)
+	if !opts.CaseSensitive {
+		ext = strings.ToLower(ext)
+	}
+	if len(opts.Extensions) > 0 && !opts.allowsExt(ext) {
+		return "", false
+	}
+	lang, ok := compoundExtLanguage(name, opts.CaseSensitive)
+	if ok && lang == dtsLanguage && opts.SkipDTS {
+		return "", false
+	}
+	if !ok {
+		lang, ok = opts.Languages[ext]
+	}
+	if !ok && opts.CaseSensitive {
+		lang, ok = caseSensitiveExtMap[ext]
+	}
+	if !ok {
+		lang, ok = languageExtMap[ext]
+	}
+	if !ok {
+		lang, ok = filenameLangMap[name]
+	}
+	if !ok && ext == "" && !compressed && shebang != nil {
+		lang = shebang()
+		ok = lang != ""
+	}
+	// An extension asked for by name counts even when it's unknown
+	if !ok && len(opts.Extensions) > 0 {
+		lang, ok = ext, true
+	}
+	if !ok && opts.IncludeOther && len(opts.Only) == 0 {
+		return otherLanguage, true
+	}
+	if !ok {
+		return "", false
+	}
+	if lang != notebookLanguage && !opts.allowsLanguage(lang) {
+		return "", false
+	}
+	// Naming a documentation language in -only or -ext is enough to
+	// count it
+	if docLanguages[lang] && !opts.Docs && len(opts.Only) == 0 && len(opts.Extensions) == 0 {
+		return "", false
+	}
+	return lang, true
+}
+
+// Language names the language a file name is counted as, going by
+// opts.Languages and CaseSensitive but none of the filters. A name
+// starting with a dot is taken as a bare extension. Files without an
+// extension are only looked up by name, not by shebang.
+func (opts Options) Language(name string) (string, bool) {
+	if strings.HasPrefix(name, ".") && filepath.Ext(name) == name {
+		name = "file" + name
+	}
+	lookup := Options{Languages: opts.Languages, CaseSensitive: opts.CaseSensitive, Docs: true}
+	return lookup.fileLanguage(name, nil)
+}
+
+// realAbs is path with symlinks resolved, made absolute so keys reached
+// from a relative root and through a link target compare equal
+func realAbs(path string) (string, error) {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(realPath)
+}
+
+// linksWithin reports whether the symlink at path resolves to somewhere
+// inside root; broken links don't
+func linksWithin(path, root string) bool {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(realRoot, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// topDir is the first directory of relPath below its root, "." for
+// files directly in it
+func (w *walker) topDir(root, relPath string) string {
+	dir := "."
+	if i := strings.IndexAny(relPath, `/\`); i > 0 {
+		dir = relPath[:i]
+	}
+	if w.prefixRoots {
+		dir = filepath.Join(root, dir)
+	}
+	return dir
+}
@@ -0,0 +1,106 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A link back into the tree must not count it twice, even from a
+// relative root whose real path isn't absolute
+func TestFollowSymlinksRelativeRoot(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "a")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"one.go", "two.go", "three.go"} {
+		if err := os.WriteFile(filepath.Join(sub, name), []byte("package a\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(dir, filepath.Join(sub, "back")); err != nil {
+		t.Skipf("can't create symlinks: %v", err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	opts := DefaultOptions()
+	opts.FollowSymlinks = true
+	for _, root := range []string{".", "a", dir} {
+		report, err := Scan([]string{root}, opts)
+		if err != nil {
+			t.Fatalf("Scan(%q): %v", root, err)
+		}
+		if report.Totals.FileCount != 3 {
+			t.Errorf("Scan(%q) counted %d files, want 3", root, report.Totals.FileCount)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"root.go", "a/one.go", "a/b/two.go"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("package x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		maxDepth int
+		files    int
+	}{
+		{"zero is no limit", 0, 3},
+		{"negative is roots only", -1, 1},
+		{"one level", 1, 2},
+		{"deeper than the tree", 5, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts Options
+			opts.MaxDepth = tt.maxDepth
+			report, err := Scan([]string{dir}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Totals.FileCount != tt.files {
+				t.Errorf("counted %d files, want %d", report.Totals.FileCount, tt.files)
+			}
+		})
+	}
+}
+
+// A report written into the tree isn't counted, whether the walk reaches
+// it from a relative root or through a symlink
+func TestSkipFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", "report.html"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := DefaultOptions()
+	opts.SkipFiles = []string{filepath.Join(dir, "report.html")}
+	for _, follow := range []bool{false, true} {
+		opts.FollowSymlinks = follow
+		report, err := Scan([]string{dir}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Totals.FileCount != 1 {
+			t.Errorf("FollowSymlinks=%v counted %d files, want 1", follow, report.Totals.FileCount)
+		}
+	}
+}
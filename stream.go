@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mrinalxdev/cli-code/scanner"
+)
+
+// streamRedraw limits how often the running totals are rewritten
+const streamRedraw = 100 * time.Millisecond
+
+// streamFiles returns a Options.OnFile callback for -stream that prints
+// a line for each language the moment its first file is counted, then
+// passes the file on to next. With live set the running totals are kept
+// on a redrawn line below. Calls are serialised by the scanner, so the
+// state needs no lock.
+func streamFiles(out io.Writer, next func(scanner.FileStats), live bool) func(scanner.FileStats) {
+	seen := make(map[string]bool)
+	var files, lines int
+	var lastDraw time.Time
+	return func(file scanner.FileStats) {
+		files++
+		lines += file.Stats.LineCount
+		if !seen[file.Language] {
+			seen[file.Language] = true
+			if live {
+				fmt.Fprintf(out, "\r\033[K")
+			}
+			fmt.Fprintf(out, "➕ %s (first file: %s)\n", file.Language, file.Path)
+			lastDraw = time.Time{}
+		}
+		if live && time.Since(lastDraw) >= streamRedraw {
+			fmt.Fprintf(out, "\r\033[K⏳ %d files, %d lines in %d languages", files, lines, len(seen))
+			lastDraw = time.Now()
+		}
+		if next != nil {
+			next(file)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+import "os"
+
+// terminalWidth returns 0 where the terminal size can't be queried
+func terminalWidth(f *os.File) int {
+	return 0
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+
+	"github.com/mrinalxdev/cli-code/scanner"
+)
+
+// treeFingerprint hashes the path, size and modtime of every file a scan
+// would count, so any edit, addition or removal changes the result
+func treeFingerprint(ctx context.Context, roots []string, opts scanner.Options) uint64 {
+	// Polling happens every few seconds; don't repeat walk errors
+	opts.Warn = nil
+	opts.Progress = nil
+
+	paths, _ := scanner.ListContext(ctx, roots, opts)
+	h := fnv.New64a()
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return h.Sum64()
+}
+
+// waitForChange polls the tree until it differs from last and then stays
+// unchanged for one more interval, which debounces bursts of saves. It
+// returns the new fingerprint, or false once ctx is cancelled.
+func waitForChange(ctx context.Context, roots []string, opts scanner.Options, interval time.Duration, last uint64) (uint64, bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	current := last
+	for {
+		select {
+		case <-ctx.Done():
+			return last, false
+		case <-ticker.C:
+		}
+
+		next := treeFingerprint(ctx, roots, opts)
+		if ctx.Err() != nil {
+			return last, false
+		}
+		if next != current {
+			current = next
+			continue
+		}
+		if current != last {
+			return current, true
+		}
+	}
+}
+
+// clearScreen wipes the terminal between watch refreshes
+func clearScreen() {
+	fmt.Print("\033[H\033[2J")
+}